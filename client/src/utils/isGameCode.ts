@@ -0,0 +1,6 @@
+// game codes are 6 letters, or words like brave-otter-42 when the server is set to hand out word codes
+const GAME_CODE = /^([a-z]{6}|[a-z]+-[a-z]+-\d{2})$/;
+
+export default function (code: string) {
+  return GAME_CODE.test(code);
+}
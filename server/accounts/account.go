@@ -0,0 +1,66 @@
+// Package accounts holds registered player accounts and checks their passwords
+package accounts
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// limits on passwords, bcrypt only uses the first 72 bytes of a password
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,20}$`)
+
+var ErrInvalidUsername = errors.New("usernames must be 3 to 20 letters, numbers, '_' or '-'")
+var ErrInvalidPassword = errors.New("passwords must be 8 to 72 characters")
+
+// Account is a registered player
+type Account struct {
+	Username     string    `json:"username"`
+	PasswordHash []byte    `json:"passwordHash"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// New creates an account, hashing its password with bcrypt
+func New(username string, password string) (*Account, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return nil, ErrInvalidPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Account{username, hash, time.Now()}, nil
+}
+
+// CheckPassword returns true if password is the account's password
+func (a *Account) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword(a.PasswordHash, []byte(password)) == nil
+}
+
+// dummyHash is compared against when there is no account so logging in takes as long either way
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("scuffed-chess dummy password"), bcrypt.DefaultCost)
+
+// CheckMissingPassword takes as long as CheckPassword but always fails, it is used when a login is for
+// an account that doesn't exist so response times don't reveal which usernames are registered
+func CheckMissingPassword(password string) bool {
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+	return false
+}
+
+// Key returns the key accounts are stored under, usernames are unique regardless of case
+func Key(username string) string {
+	return strings.ToLower(username)
+}
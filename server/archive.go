@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/storage"
+)
+
+// page sizes of the archive API
+const (
+	DEFAULT_PAGE_SIZE = 20
+	MAX_PAGE_SIZE     = 100
+)
+
+// archiveGame saves a finished game to the archive
+func archiveGame(g *c.GameController) {
+	r := g.Record()
+	if r == nil {
+		return
+	}
+
+	if err := store.ArchiveGame(r); err != nil {
+		gameLogger(g).Error("failed to archive game", "err", err)
+	}
+}
+
+// publicRecord returns a copy of r that can be served to anyone, the chat is left out since only the
+// players and spectators of the game should read it
+func publicRecord(r *c.GameRecord) *c.GameRecord {
+	public := *r
+	public.Chat = nil
+
+	return &public
+}
+
+// handleArchivedGame returns the most recent finished game with the code in the path /api/games/{code},
+// as PGN if format=pgn is given. Games played in private rooms aren't served
+func handleArchivedGame(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	code := strings.TrimPrefix(r.URL.Path, "/api/games/")
+	record, err := store.ArchivedGame(code)
+	if err == storage.ErrNotFound || (err == nil && record.Private) {
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	} else if err != nil {
+		logger.Error("failed to load archived game", "game", code, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to load game")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "pgn" {
+		w.Header().Set("Content-Type", "application/x-chess-pgn")
+		w.Write([]byte(record.PGN))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, publicRecord(record))
+}
+
+// handleArchivedGames lists finished games newest first, filtered by the query parameters
+// player, result, variant, from and to (RFC 3339 times or YYYY-MM-DD dates) and paginated with page and limit.
+// player is an account's username, guests are found with "guest:" before their name.
+// Games played in private rooms aren't listed
+func handleArchivedGames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	params := r.URL.Query()
+
+	page, err := intParam(params.Get("page"), 1)
+	if err != nil || page < 1 {
+		writeError(w, http.StatusBadRequest, "invalid page")
+		return
+	}
+	limit, err := intParam(params.Get("limit"), DEFAULT_PAGE_SIZE)
+	if err != nil || limit < 1 || limit > MAX_PAGE_SIZE {
+		writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(MAX_PAGE_SIZE))
+		return
+	}
+
+	from, err := timeParam(params.Get("from"), false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from")
+		return
+	}
+	to, err := timeParam(params.Get("to"), true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to")
+		return
+	}
+
+	result := params.Get("result")
+	switch result {
+	case "", "1-0", "0-1", "1/2-1/2", "draw":
+	case "win", "loss":
+		if params.Get("player") == "" {
+			writeError(w, http.StatusBadRequest, "result "+result+" needs a player")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "invalid result")
+		return
+	}
+
+	// one extra game is fetched to tell if there is another page
+	games, err := store.QueryArchive(storage.ArchiveQuery{
+		Player:  params.Get("player"),
+		Result:  result,
+		Variant: params.Get("variant"),
+		From:    from,
+		To:      to,
+		Public:  true,
+		Offset:  (page - 1) * limit,
+		Limit:   limit + 1,
+	})
+	if err != nil {
+		logger.Error("failed to query archive", "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to load games")
+		return
+	}
+
+	hasMore := len(games) > limit
+	if hasMore {
+		games = games[:limit]
+	}
+	for i, g := range games {
+		games[i] = publicRecord(g)
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Games   []*c.GameRecord `json:"games"`
+		Page    int             `json:"page"`
+		Limit   int             `json:"limit"`
+		HasMore bool            `json:"hasMore"`
+	}{games, page, limit, hasMore})
+}
+
+func intParam(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// timeParam parses an RFC 3339 time or a YYYY-MM-DD date, dates are the end of the day when endOfDay is set
+func timeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, err
+	}
+
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	return t, nil
+}
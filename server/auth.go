@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/freddie-nelson/scuffed-chess/server/accounts"
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/storage"
+	socketio "github.com/googollee/go-socket.io"
+)
+
+// SESSION_COOKIE is the cookie holding a logged in account's session id
+const SESSION_COOKIE = "session"
+
+// LOGIN_TTL is how long an account stays logged in for
+const LOGIN_TTL = 30 * 24 * time.Hour
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type accountJSON struct {
+	Username  string `json:"username"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+func newAccountJSON(a *accounts.Account) accountJSON {
+	return accountJSON{a.Username, unixMillis(a.CreatedAt)}
+}
+
+// handleRegister creates an account and logs it in
+func handleRegister(w http.ResponseWriter, r *http.Request) {
+	var creds credentials
+	if !decodeCredentials(w, r, &creds) {
+		return
+	}
+
+	a, err := accounts.New(creds.Username, creds.Password)
+	if err == accounts.ErrInvalidUsername || err == accounts.ErrInvalidPassword {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		logger.Error("failed to create account", "username", creds.Username, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to create account")
+		return
+	}
+
+	if err := store.CreateAccount(a); err == storage.ErrAccountExists {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		logger.Error("failed to save account", "username", a.Username, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to create account")
+		return
+	}
+
+	if !startSession(w, a) {
+		return
+	}
+
+	logger.Info("registered", "username", a.Username)
+	writeJSON(w, http.StatusCreated, newAccountJSON(a))
+}
+
+// handleLogin logs an account in, setting the session cookie
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	var creds credentials
+	if !decodeCredentials(w, r, &creds) {
+		return
+	}
+
+	a, err := store.Account(creds.Username)
+	if err != nil && err != storage.ErrNotFound {
+		logger.Error("failed to load account", "username", creds.Username, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to log in")
+		return
+	}
+
+	// accounts that don't exist still check a password so they take as long to refuse as wrong passwords
+	var valid bool
+	if a != nil {
+		valid = a.CheckPassword(creds.Password)
+	} else {
+		valid = accounts.CheckMissingPassword(creds.Password)
+	}
+
+	if !valid {
+		writeError(w, http.StatusUnauthorized, "invalid username or password")
+		return
+	}
+
+	if !startSession(w, a) {
+		return
+	}
+
+	logger.Info("logged in", "username", a.Username)
+	writeJSON(w, http.StatusOK, newAccountJSON(a))
+}
+
+// handleLogout ends the request's session and clears the session cookie
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if cookie, err := r.Cookie(SESSION_COOKIE); err == nil {
+		if err := store.DeleteSession(cookie.Value); err != nil {
+			logger.Error("failed to delete session", "err", err)
+		}
+	}
+
+	setSessionCookie(w, "", -1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAccount returns the logged in account
+func handleAccount(w http.ResponseWriter, r *http.Request) {
+	username := requestAccount(r)
+	if username == "" {
+		writeError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+
+	a, err := store.Account(username)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "not logged in")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newAccountJSON(a))
+}
+
+// requestAccount returns the username of the account logged in with the request's session cookie,
+// empty if there isn't one
+func requestAccount(r *http.Request) string {
+	cookie, err := r.Cookie(SESSION_COOKIE)
+	if err != nil {
+		return ""
+	}
+
+	username, err := store.Session(cookie.Value)
+	if err != nil {
+		return ""
+	}
+
+	return username
+}
+
+// socketAccount returns the username of the account logged in when the socket connected,
+// empty for guests
+func socketAccount(s socketio.Conn) string {
+	return requestAccount(&http.Request{Header: s.RemoteHeader()})
+}
+
+// newPlayer creates a player of color for the socket, binding the socket's account to it if it is logged in
+func newPlayer(s socketio.Conn, username string, color int, opponent bool) *c.Player {
+	return connectionPlayer(newSocketConnection(s), socketAccount(s), username, color, opponent)
+}
+
+// connectionPlayer creates a player of color on conn bound to account, which is empty for guests
+func connectionPlayer(conn c.Connection, account string, username string, color int, opponent bool) *c.Player {
+	p := c.NewPlayer(username, color, opponent, conn)
+	if account != "" {
+		p.SetAccount(account)
+	}
+
+	return p
+}
+
+func startSession(w http.ResponseWriter, a *accounts.Account) bool {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to log in")
+		return false
+	}
+
+	id := hex.EncodeToString(b)
+	if err := store.SaveSession(id, a.Username, time.Now().Add(LOGIN_TTL)); err != nil {
+		logger.Error("failed to save session", "username", a.Username, "err", err)
+		writeError(w, http.StatusInternalServerError, "failed to log in")
+		return false
+	}
+
+	setSessionCookie(w, id, int(LOGIN_TTL.Seconds()))
+	return true
+}
+
+// setSessionCookie sets the session cookie, the client is served from another origin in production
+// so the cookie has to be allowed on cross site requests there
+func setSessionCookie(w http.ResponseWriter, id string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if cfg.Production {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+func decodeCredentials(w http.ResponseWriter, r *http.Request, creds *credentials) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return false
+	}
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(creds); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+// unixMillis returns t in milliseconds since the unix epoch
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -1,9 +1,6 @@
 package chess
 
-import (
-	"log"
-	"math"
-)
+import "math"
 
 const Size = 8
 
@@ -106,8 +103,6 @@ func (b *Board) MovePiece(start *Spot, destination *Spot, turn int) bool {
 		rookDest.piece = rookPiece
 		rookDest.containsPiece = true
 
-		log.Printf("rookSpot: (%d, %d), rookDest: (%d, %d)", rookSpot.file, rookSpot.rank, rookDest.file, rookDest.rank)
-
 		castling = true
 	}
 
@@ -211,3 +206,24 @@ func (b *Board) GetKingSpot(color int) *Spot {
 
 	return king
 }
+
+// HasInsufficientMaterial returns true if color only has a king, or a king and a single bishop or knight,
+// so can never checkmate their opponent
+func (b *Board) HasInsufficientMaterial(color int) bool {
+	minorPieces := 0
+	for rank := 0; rank < Size; rank++ {
+		for file := 0; file < Size; file++ {
+			s := b.grid[file][rank]
+			if !s.containsPiece || s.piece.color != color || s.piece.class == King {
+				continue
+			}
+
+			if s.piece.class != Bishop && s.piece.class != Knight {
+				return false
+			}
+			minorPieces++
+		}
+	}
+
+	return minorPieces <= 1
+}
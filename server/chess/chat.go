@@ -0,0 +1,116 @@
+package chess
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Channels chat messages are sent in, players and spectators can't see each other's messages
+const (
+	ChannelPlayers    = "players"
+	ChannelSpectators = "spectators"
+)
+
+// MaxChatLength is the most characters a chat message can have
+const MaxChatLength = 280
+
+var ErrChatEmpty = errors.New("chat message is empty")
+var ErrChatTooLong = errors.New("chat message is too long")
+var ErrNotInGame = errors.New("connection isn't playing or watching the game")
+
+// ChatMessage is a message sent in a game's chat, it is kept with the game's record
+type ChatMessage struct {
+	Channel string    `json:"channel"`
+	Name    string    `json:"name"`
+	Text    string    `json:"text"`
+	Time    time.Time `json:"time"`
+}
+
+type chatMessageJSON struct {
+	Channel string `json:"channel"`
+	Name    string `json:"name"`
+	Text    string `json:"text"`
+	Time    int64  `json:"time"`
+}
+
+func newChatMessageJSON(m ChatMessage) chatMessageJSON {
+	return chatMessageJSON{m.Channel, m.Name, m.Text, unixMillis(m.Time)}
+}
+
+// Chat sends text from the connection with id to the channel it can talk in, players talk to each other
+// and spectators talk to the other spectators. Messages are sent with game:chat as JSON, which escapes
+// HTML so clients can't be sent markup
+func (g *GameController) Chat(id string, text string) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ErrChatEmpty
+	} else if utf8.RuneCountInString(text) > MaxChatLength {
+		return ErrChatTooLong
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if p := g.playerWithID(id); p != nil {
+		m := g.addChat(ChannelPlayers, p.name, text)
+
+		p.emit("game:chat", m)
+		if opponent := g.opponentOf(p); opponent != nil && !opponent.mutedOpponent {
+			opponent.emit("game:chat", m)
+		}
+
+		return nil
+	}
+
+	if s, watching := g.spectators[id]; watching {
+		m := g.addChat(ChannelSpectators, s.name, text)
+		for _, other := range g.spectators {
+			other.emit("game:chat", m)
+		}
+
+		return nil
+	}
+
+	return ErrNotInGame
+}
+
+// addChat records a message
+// @returns the game:chat data to send for it
+func (g *GameController) addChat(channel string, name string, text string) string {
+	m := ChatMessage{channel, name, text, time.Now()}
+	g.chat = append(g.chat, m)
+
+	data, _ := json.Marshal(newChatMessageJSON(m))
+	return string(data)
+}
+
+// Mute stops or starts sending the chat messages of the opponent of the player on the connection with id to them
+// @returns wether the connection is playing the game
+func (g *GameController) Mute(id string, muted bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.playerWithID(id)
+	if p == nil {
+		return false
+	}
+
+	p.mutedOpponent = muted
+	return true
+}
+
+// chatHistoryJSON returns the messages sent in channel so far
+func (g *GameController) chatHistoryJSON(channel string) string {
+	history := []chatMessageJSON{}
+	for _, m := range g.chat {
+		if m.Channel == channel {
+			history = append(history, newChatMessageJSON(m))
+		}
+	}
+
+	data, _ := json.Marshal(history)
+	return string(data)
+}
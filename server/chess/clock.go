@@ -0,0 +1,120 @@
+package chess
+
+import "time"
+
+// Clock tracks how much time a player has left, it uses the monotonic clock
+// so changes to the wall clock don't affect game time
+type Clock struct {
+	remaining time.Duration
+	running   bool
+	resumed   time.Time
+
+	// delay is what is left of the current turn's delay, time spent within it isn't charged
+	delay time.Duration
+	// turnElapsed is how long the clock has run for during the current turn
+	turnElapsed time.Duration
+}
+
+// NewClock creates a stopped clock with remaining time left on it
+func NewClock(remaining time.Duration) *Clock {
+	return &Clock{remaining: remaining}
+}
+
+// Remaining returns the time left on the clock
+func (c *Clock) Remaining() time.Duration {
+	if !c.running {
+		return c.remaining
+	}
+
+	return c.remaining - c.charge(time.Since(c.resumed))
+}
+
+// UntilFlag returns how long until the clock runs out if it keeps running
+func (c *Clock) UntilFlag() time.Duration {
+	if !c.running {
+		return c.remaining + c.delay
+	}
+
+	return c.remaining + c.delay - time.Since(c.resumed)
+}
+
+// Running returns true if the clock is counting down
+func (c *Clock) Running() bool {
+	return c.running
+}
+
+// Start starts the clock for a new turn, the first delay of the turn isn't charged
+func (c *Clock) Start(delay time.Duration) {
+	c.delay = delay
+	c.turnElapsed = 0
+	c.Resume()
+}
+
+// Resume continues counting down from where the clock was paused
+func (c *Clock) Resume() {
+	if c.running {
+		return
+	}
+
+	c.running = true
+	c.resumed = time.Now()
+}
+
+// Pause stops the clock without ending the turn
+func (c *Clock) Pause() {
+	if !c.running {
+		return
+	}
+
+	elapsed := time.Since(c.resumed)
+	c.remaining -= c.charge(elapsed)
+	c.turnElapsed += elapsed
+	c.delay = maxDuration(c.delay-elapsed, 0)
+	c.running = false
+}
+
+// Stop stops the clock at the end of a turn
+// @returns how long the clock ran for during the turn
+func (c *Clock) Stop() time.Duration {
+	c.Pause()
+	c.delay = 0
+
+	return c.turnElapsed
+}
+
+// Add adds d to the time left on the clock, d can be negative
+func (c *Clock) Add(d time.Duration) {
+	c.remaining += d
+}
+
+// Set sets the time left on the clock
+func (c *Clock) Set(remaining time.Duration) {
+	running := c.running
+	c.Pause()
+
+	c.remaining = remaining
+	if running {
+		c.Resume()
+	}
+}
+
+// charge returns how much of elapsed is taken off the clock after any delay
+func (c *Clock) charge(elapsed time.Duration) time.Duration {
+	return maxDuration(elapsed-c.delay, 0)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+
+	return b
+}
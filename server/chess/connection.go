@@ -0,0 +1,12 @@
+package chess
+
+// Connection is how a player or spectator is sent the game's events. The server adapts its socket.io
+// connections to it, bots, tests and other transports can take part in games with their own implementations
+type Connection interface {
+	// ID uniquely identifies the connection among those connected to the server
+	ID() string
+	// Emit sends event with args to the other end of the connection
+	Emit(event string, args ...interface{})
+	// Close disconnects the other end of the connection
+	Close() error
+}
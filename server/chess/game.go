@@ -1,27 +1,62 @@
 package chess
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 )
 
+// End states a game can finish in
+const (
+	EndCheckmate            = "checkmate"
+	EndStalemate            = "stalemate"
+	EndTimeout              = "timeout"
+	EndInsufficientMaterial = "insufficient material"
+	EndDisconnect           = "disconnect"
+	EndAbandoned            = "abandoned"
+	// EndMoveLimit is a draw once the game reaches MoveLimit full moves
+	EndMoveLimit = "move limit"
+)
+
+// MoveLimit is the number of full moves a game is drawn after
+const MoveLimit = 50
+
+// Draw is the winner of a game that ended without either color winning
+const Draw = -1
+
+// VariantStandard is standard chess, the only variant games can be played in for now
+const VariantStandard = "standard"
+
 // CastlingRights stores what side a player can castle
 type CastlingRights struct {
 	queenside bool
 	kingside  bool
 }
 
+// Move is a move played in a game, it is stored so games can be replayed
+type Move struct {
+	File      int    `json:"file"`
+	Rank      int    `json:"rank"`
+	DFile     int    `json:"dFile"`
+	DRank     int    `json:"dRank"`
+	Promotion int    `json:"promotion"`
+	SAN       string `json:"san"`
+}
+
 // GameController controls top level game logic
 type GameController struct {
 	color         int
 	opponentColor int
 	board         *Board
 	started       bool
-	startTime     int
+	startTime     time.Time
+	endTime       time.Time
 	ended         bool
 	endState      string
+	winner        int
 	turn          int
 	halfmoves     int
 	fullmoves     int
@@ -29,16 +64,50 @@ type GameController struct {
 	whiteCastling *CastlingRights
 	blackCastling *CastlingRights
 
+	timeControl *TimeControl
+	moves       []Move
+	rated       bool
+	rematched   bool
+	// ratingChanges are indexed by color and set once a rated game's ratings have been updated
+	ratingChanges [2]*RatingChange
+	onEnd         func(g *GameController)
+	flagTimer     *time.Timer
+	pingTimer     *time.Timer
+	stopped       bool
+	// paused is set while the clock of the player to move is stopped mid turn, no moves can be made
+	paused bool
+
+	// mu serializes everything that touches the game, moves, clock timers and broadcasts,
+	// exported methods lock it so they can be called from any goroutine
+	mu sync.Mutex
+
+	// You and Opponent are set while the game is created, afterwards they should only
+	// be changed through the game's methods
 	You      *Player
 	Opponent *Player
 
+	// spectators maps connection ids to the spectators watching the game
+	spectators map[string]*spectator
+
+	chat []ChatMessage
+
+	// password is the bcrypt hash of the room password, reservedFor the account the open seat is
+	// reserved for and invites the keys of the unused invites to the open seat
+	password    []byte
+	reservedFor string
+	invites     map[string]bool
+
 	code string
 }
 
-// NewGame creates the initial game state
-func NewGame(code string) *GameController {
+// NewGame creates the initial game state, played with the time control tc
+func NewGame(code string, tc *TimeControl) *GameController {
 	var g GameController
 
+	g.code = code
+	g.timeControl = tc
+	g.spectators = make(map[string]*spectator)
+
 	g.whiteCastling = &CastlingRights{true, true}
 	g.blackCastling = &CastlingRights{true, true}
 
@@ -52,17 +121,415 @@ func NewGame(code string) *GameController {
 }
 
 func (g *GameController) StartGame() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
 	if g.started {
 		return
 	}
 
 	g.started = true
-	g.startTime = int(time.Now().UnixNano() / 100000)
+	g.startTime = time.Now()
+
+	g.timeControl.start(g.You)
+	g.timeControl.start(g.Opponent)
+
+	g.startTimers()
+}
+
+// startTimers starts the turn of the player to move and the timers that run while the game is in progress
+func (g *GameController) startTimers() {
+	g.timeControl.startTurn(g.CurrentlyPlaying())
+	g.scheduleFlag()
+
+	// latency doesn't matter when players have days to move
+	if g.timeControl.Mode != Correspondence {
+		g.pingTimer = time.AfterFunc(0, g.ping)
+	}
+}
+
+// Pause stops the clock of the player to move without ending their turn, moves aren't accepted until
+// the game is resumed
+func (g *GameController) Pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.pause()
+}
+
+func (g *GameController) pause() {
+	if !g.started || g.ended {
+		return
+	}
+
+	g.paused = true
+	g.CurrentlyPlaying().clock.Pause()
+	if g.flagTimer != nil {
+		g.flagTimer.Stop()
+	}
+}
+
+// Resume restarts the clock of the player to move after the game was paused
+func (g *GameController) Resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.resume()
+}
+
+func (g *GameController) resume() {
+	if !g.started || g.ended || !g.paused {
+		return
+	}
+
+	g.paused = false
+	g.CurrentlyPlaying().clock.Resume()
+	g.scheduleFlag()
+}
+
+// Stop cancels the game's timers, it should be called once the game is discarded
+func (g *GameController) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.stopped = true
+	g.stopTimers()
+}
+
+// TimeControl returns the time control the game is played with
+func (g *GameController) TimeControl() *TimeControl {
+	return g.timeControl
+}
+
+// Variant returns the variant of chess the game is played in
+func (g *GameController) Variant() string {
+	return VariantStandard
+}
+
+// Code returns the code players use to join the game
+func (g *GameController) Code() string {
+	return g.code
+}
+
+// IsCorrespondence returns true if the game is played over days and shouldn't end when a player disconnects
+func (g *GameController) IsCorrespondence() bool {
+	return g.timeControl.Mode == Correspondence
+}
+
+// IsStarted returns true once both players have joined and the game has started
+func (g *GameController) IsStarted() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.started
+}
+
+// IsEnded returns true once the game has finished
+func (g *GameController) IsEnded() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.ended
+}
+
+// White returns the player playing white
+func (g *GameController) White() *Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.playerOfColor(White)
+}
+
+// Black returns the player playing black
+func (g *GameController) Black() *Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.playerOfColor(Black)
+}
+
+// EndState returns how the game ended, empty if it hasn't
+func (g *GameController) EndState() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.endState
+}
+
+// Winner returns the color that won the game, Draw if neither did
+func (g *GameController) Winner() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.winner
+}
+
+// MoveCount returns the number of moves played by both players so far
+func (g *GameController) MoveCount() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return len(g.moves)
+}
+
+// OnEnd sets f to be called as soon as the game ends. f is called with the game locked so it mustn't call the
+// game's methods, slow work such as saving the game should be started in its own goroutine
+func (g *GameController) OnEnd(f func(g *GameController)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.onEnd = f
+}
+
+// Open binds the player with the given key to the connection conn, e.g. when they rejoin after a disconnect.
+// A paused game is resumed once both players have opened it
+// @returns the player that was opened or nil if no player has the key
+func (g *GameController) Open(key string, conn Connection) *Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, p := range []*Player{g.You, g.Opponent} {
+		if p != nil && p.key == key {
+			if !p.disconnectedAt.IsZero() && !g.ended {
+				g.opponentOf(p).emit("game:opponent-reconnected")
+			}
+
+			p.SetConnection(conn)
+			p.disconnectedAt = time.Time{}
+			p.emit("game:chat-history", g.chatHistoryJSON(ChannelPlayers))
+
+			if opponent := g.opponentOf(p); opponent != nil && opponent.conn != nil {
+				g.resume()
+			}
+
+			return p
+		}
+	}
+
+	return nil
+}
+
+// Disconnect unbinds the player on the connection with id and lets their opponent know,
+// they can reopen the game with their key
+// @returns the player that disconnected or nil if the connection isn't playing
+func (g *GameController) Disconnect(id string) *Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.playerWithID(id)
+	if p == nil {
+		return nil
+	}
+
+	p.SetConnection(nil)
+	p.disconnectedAt = time.Now()
+
+	if g.started && !g.ended {
+		g.opponentOf(p).emit("game:opponent-disconnected")
+	}
+
+	return p
+}
+
+// GraceExpired is called once p has had grace to reconnect, if they are still disconnected their
+// opponent is told they can claim the win. If the opponent has gone too the game is abandoned as a draw,
+// checking and abandoning together so a player who rejoins meanwhile keeps the game going
+// @returns true if the game was abandoned
+func (g *GameController) GraceExpired(p *Player, grace time.Duration) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.started || g.ended || p.disconnectedAt.IsZero() || time.Since(p.disconnectedAt) < grace {
+		return false
+	}
+
+	opponent := g.opponentOf(p)
+	if opponent == nil || !opponent.disconnectedAt.IsZero() {
+		g.end(EndAbandoned, Draw)
+		return true
+	}
+
+	opponent.emit("game:claim-available")
+	return false
+}
+
+// ClaimWin ends the game in favour of the player on the connection with id if their opponent
+// has been disconnected for at least grace
+// @returns wether the claim was accepted
+func (g *GameController) ClaimWin(id string, grace time.Duration) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.playerWithID(id)
+	if p == nil || !g.started || g.ended {
+		return false
+	}
+
+	opponent := g.opponentOf(p)
+	if opponent == nil || opponent.disconnectedAt.IsZero() || time.Since(opponent.disconnectedAt) < grace {
+		return false
+	}
+
+	g.end(EndAbandoned, g.colorOf(p))
+	return true
+}
+
+// Join seats p as the game's opponent, playing the color the creator of the game didn't choose.
+// p needs the room's password or the key of an unused invite if the room has a password
+// @returns why p couldn't join, nil if they were seated
+func (g *GameController) Join(p *Player, password string, invite string) error {
+	g.mu.Lock()
+	err := g.checkSeat(p, invite)
+	hash := g.password
+	g.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	// the password is checked without the game's lock so moves and broadcasts aren't held up by bcrypt
+	if invite == "" {
+		if err := checkPassword(hash, password); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// the seat may have been taken or the invite used while the password was checked
+	if err := g.checkSeat(p, invite); err != nil {
+		return err
+	}
+
+	// the seat is taken so the other invites are no use anymore
+	g.invites = nil
+
+	p.color = g.GetOpponentColor(g.You.color)
+	g.Opponent = p
+	return nil
+}
+
+// PlayerWithID returns the player on the connection with id or nil if they aren't playing
+func (g *GameController) PlayerWithID(id string) *Player {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.playerWithID(id)
+}
+
+func (g *GameController) playerWithID(id string) *Player {
+	if g.You.CompareID(id) {
+		return g.You
+	} else if g.Opponent.CompareID(id) {
+		return g.Opponent
+	}
+
+	return nil
+}
+
+// Leave removes the player on the connection with id from the game and stops it, leaving a game in
+// progress ends it as a disconnect won by the player still in the game, who is sent game:end-state along
+// with the spectators
+// @returns wether the player left and the player still in the game, if any
+func (g *GameController) Leave(id string) (bool, *Player) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.playerWithID(id)
+	if p == nil {
+		return false, nil
+	}
+	remaining := g.opponentOf(p)
+
+	// players stay seated in games that have started so the finished game can be recorded
+	ended := false
+	if g.started {
+		if !g.ended {
+			g.end(EndDisconnect, g.colorOf(remaining))
+			ended = true
+		}
+		p.SetConnection(nil)
+	} else if p == g.You {
+		g.You = nil
+	} else {
+		g.Opponent = nil
+	}
+
+	g.stopped = true
+	g.stopTimers()
+
+	// a game that had already ended keeps the result that was shown
+	if ended {
+		remaining.emit("game:end-state", EndDisconnect)
+		for _, s := range g.spectators {
+			s.emit("game:end-state", EndDisconnect)
+		}
+	}
+
+	return true, remaining
+}
+
+// MakePlayerMove makes a move for the player on the connection with id if it is their turn
+// @returns wether the move was made or not
+func (g *GameController) MakePlayerMove(id string, file, rank, dFile, dRank, promotion int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.playerWithID(id)
+	if p == nil || !g.IsCurrentlyPlaying(p) {
+		return false
+	}
+
+	return g.makeMove(file, rank, dFile, dRank, promotion)
 }
 
 // MakeMove checks if move is valid and then plays that move if it is
 // @returns wether the move was made or not
 func (g *GameController) MakeMove(file, rank, dFile, dRank, promotion int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.makeMove(file, rank, dFile, dRank, promotion)
+}
+
+func (g *GameController) makeMove(file, rank, dFile, dRank, promotion int) bool {
+	if !g.started || g.ended || g.paused {
+		return false
+	}
+
+	// moves made after the player's flag has fallen don't count, the flag timer ends the game
+	if g.untilFlag() <= 0 {
+		return false
+	}
+
+	player := g.CurrentlyPlaying()
+	if !g.playMove(file, rank, dFile, dRank, promotion) {
+		return false
+	}
+
+	// update time control, crediting back the time the move spent in transit
+	spent := g.timeControl.endTurn(player)
+	credit := player.lag.compensate(spent)
+	player.clock.Add(credit)
+
+	// in hourglass the time one player uses runs into their opponent's clock
+	if g.timeControl.Mode == Hourglass {
+		g.opponentOf(player).clock.Add(spent - credit)
+	}
+
+	g.NextTurn(g.turn, g.GetOpponentColor(g.turn))
+	if !g.ended {
+		g.timeControl.startTurn(g.CurrentlyPlaying())
+	}
+	g.scheduleFlag()
+
+	return true
+}
+
+// playMove plays the move on the board and records it if it is valid, it doesn't pass the turn
+// @returns wether the move was played or not
+func (g *GameController) playMove(file, rank, dFile, dRank, promotion int) bool {
 	if g.board.IsSpotOffBoard(file, rank) || g.board.IsSpotOffBoard(dFile, dRank) {
 		return false
 	}
@@ -89,7 +556,9 @@ func (g *GameController) MakeMove(file, rank, dFile, dRank, promotion int) bool
 	}
 
 	movedPiece := false
+	san := ""
 	if valid {
+		san = g.sanPrefix(start, dest, castlingRights)
 		movedPiece = g.board.MovePiece(start, dest, g.turn)
 	}
 
@@ -99,27 +568,14 @@ func (g *GameController) MakeMove(file, rank, dFile, dRank, promotion int) bool
 		if g.turn == Black {
 			lastRank = Size - 1
 		}
+		promoted := false
 		if dest.piece.class == Pawn && dest.piece.color == g.turn && dest.rank == lastRank && (promotion == Queen || promotion == Rook || promotion == Bishop || promotion == Knight) {
 			dest.piece.class = promotion
+			promoted = true
 		}
 
-		// update time control
-		player := g.CurrentlyPlaying()
-		now := int(time.Now().UnixNano() / 100000)
-
-		// correct last move time for first moves
-		if player.timeOfLastMove == 0 {
-			if g.turn == White {
-				player.timeOfLastMove = g.startTime
-			} else {
-				player.timeOfLastMove = g.You.timeOfLastMove
-			}
-		}
-
-		player.time -= now - player.timeOfLastMove
-		player.timeOfLastMove = now
-
-		g.NextTurn(g.turn, g.GetOpponentColor(g.turn))
+		san += g.sanSuffix(dest, g.turn, promoted)
+		g.moves = append(g.moves, Move{file, rank, dFile, dRank, promotion, san})
 
 		return true
 	} else {
@@ -127,7 +583,26 @@ func (g *GameController) MakeMove(file, rank, dFile, dRank, promotion int) bool
 	}
 }
 
+// GetPlayerValidMoves returns the valid moves of the piece at file, rank for the player on the connection with id
+func (g *GameController) GetPlayerValidMoves(id string, file, rank int) []Spot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if p := g.playerWithID(id); p != nil {
+		return g.getValidMoves(file, rank, g.GetOpponentColor(p.color))
+	}
+
+	return []Spot{}
+}
+
 func (g *GameController) GetValidMoves(file, rank, opponentColor int) []Spot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.getValidMoves(file, rank, opponentColor)
+}
+
+func (g *GameController) getValidMoves(file, rank, opponentColor int) []Spot {
 	if g.board.IsSpotOffBoard(file, rank) {
 		return []Spot{}
 	}
@@ -154,28 +629,296 @@ func (g *GameController) CurrentlyPlaying() *Player {
 		return nil
 	}
 
-	if g.turn == White {
+	return g.playerOfColor(g.turn)
+}
+
+// playerOfColor returns the player playing color or nil if they haven't joined
+func (g *GameController) playerOfColor(color int) *Player {
+	if g.You != nil && g.You.color == color {
 		return g.You
-	} else {
+	} else if g.Opponent != nil && g.Opponent.color == color {
+		return g.Opponent
+	}
+
+	return nil
+}
+
+// colorOf returns the color p is playing
+func (g *GameController) colorOf(p *Player) int {
+	return p.color
+}
+
+func (g *GameController) opponentOf(p *Player) *Player {
+	if p == g.You {
 		return g.Opponent
 	}
+
+	return g.You
 }
 
 func (g *GameController) IsCurrentlyPlaying(p *Player) bool {
 	return p != nil && p == g.CurrentlyPlaying()
 }
 
-func (g *GameController) BroadcastData() {
+// scheduleFlag sets the flag timer to fire when the player to move runs out of time
+func (g *GameController) scheduleFlag() {
+	if g.flagTimer != nil {
+		g.flagTimer.Stop()
+	}
+
+	if !g.started || g.ended || !g.CurrentlyPlaying().clock.Running() {
+		return
+	}
+
+	g.flagTimer = time.AfterFunc(maxDuration(g.untilFlag(), 0), g.checkFlag)
+}
+
+// untilFlag returns how long until the player to move runs out of time, allowing for the
+// lag compensation they would get if their move is already in transit
+func (g *GameController) untilFlag() time.Duration {
+	player := g.CurrentlyPlaying()
+	return player.clock.UntilFlag() + player.lag.Compensation()
+}
+
+// checkFlag ends the game on time if the player to move has run out of time
+func (g *GameController) checkFlag() {
+	g.mu.Lock()
+
+	if !g.started || g.ended || g.stopped {
+		g.mu.Unlock()
+		return
+	}
+
+	player := g.CurrentlyPlaying()
+	if g.untilFlag() > 0 {
+		g.scheduleFlag()
+		g.mu.Unlock()
+		return
+	}
+
+	player.clock.Stop()
+	player.clock.Set(0)
+
+	// a player can't lose on time to an opponent who has no way of checkmating them
+	opponentColor := g.GetOpponentColor(g.turn)
+	if g.board.HasInsufficientMaterial(opponentColor) {
+		g.end(EndInsufficientMaterial, Draw)
+	} else {
+		g.end(EndTimeout, opponentColor)
+	}
+
+	g.mu.Unlock()
+
+	g.BroadcastData()
+}
+
+// end finishes the game with the given end state and winning color (or Draw)
+func (g *GameController) end(state string, winner int) {
+	// black has less time in armageddon so draws on the board count as a win for black, games both
+	// players abandoned are still drawn
+	if winner == Draw && g.timeControl.Mode == Armageddon && isBoardDraw(state) {
+		winner = Black
+	}
+
+	g.ended = true
+	g.endTime = time.Now()
+	g.endState = state
+	g.winner = winner
+
+	if g.started {
+		g.CurrentlyPlaying().clock.Pause()
+	}
+	g.stopTimers()
+
+	if g.onEnd != nil {
+		g.onEnd(g)
+	}
+}
+
+// isBoardDraw returns true if the end state is a draw decided by the position on the board
+func isBoardDraw(state string) bool {
+	return state == EndStalemate || state == EndInsufficientMaterial || state == EndMoveLimit
+}
+
+func (g *GameController) stopTimers() {
+	if g.flagTimer != nil {
+		g.flagTimer.Stop()
+	}
+	if g.pingTimer != nil {
+		g.pingTimer.Stop()
+	}
+}
+
+// ping sends both players a clock:ping so their latency can be measured, it repeats until the game ends
+func (g *GameController) ping() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.ended || g.stopped {
+		return
+	}
+
+	for _, p := range []*Player{g.You, g.Opponent} {
+		data, _ := json.Marshal(struct {
+			ID         int   `json:"id"`
+			ServerTime int64 `json:"serverTime"`
+		}{p.lag.Ping(), unixMillis(time.Now())})
+
+		p.emit("clock:ping", string(data))
+	}
+
+	g.pingTimer = time.AfterFunc(pingInterval, g.ping)
+}
+
+// Pong records the reply to a clock:ping from the player on the connection with id
+// @returns wether the pong was accepted
+func (g *GameController) Pong(id string, ping int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, p := range []*Player{g.You, g.Opponent} {
+		if p != nil && p.CompareID(id) {
+			return p.lag.Pong(ping)
+		}
+	}
+
+	return false
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Result returns the result of the game in PGN notation, "*" while the game is in progress
+func (g *GameController) Result() string {
+	if !g.ended {
+		return "*"
+	}
+
+	switch g.winner {
+	case White:
+		return "1-0"
+	case Black:
+		return "0-1"
+	default:
+		return "1/2-1/2"
+	}
+}
+
+// BroadcastData sends the game's state to both players and the spectators, nothing is sent until both
+// players have joined
+// @returns the number of players it wasn't sent to because they are disconnected
+func (g *GameController) BroadcastData() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.You == nil || g.Opponent == nil {
+		return 0
+	}
+
 	fen := g.toFENString()
 
-	g.You.s.Emit("game:fen", fen)
-	g.Opponent.s.Emit("game:fen", fen)
+	g.You.emit("game:fen", fen)
+	g.Opponent.emit("game:fen", fen)
+
+	g.You.emit("game:players", g.playersJSON(g.You, g.Opponent))
+	g.Opponent.emit("game:players", g.playersJSON(g.Opponent, g.You))
 
-	g.You.s.Emit("game:players", fmt.Sprintf("{ \"you\": { \"username\": \"%s\", \"time\": %d }, \"opponent\": { \"username\": \"%s\", \"time\": %d } }", g.You.name, g.You.time, g.Opponent.name, g.Opponent.time))
-	g.Opponent.s.Emit("game:players", fmt.Sprintf("{ \"you\": { \"username\": \"%s\", \"time\": %d }, \"opponent\": { \"username\": \"%s\", \"time\": %d } }", g.Opponent.name, g.Opponent.time, g.You.name, g.You.time))
+	g.You.emit("game:end-state", g.endState)
+	g.Opponent.emit("game:end-state", g.endState)
+
+	if g.ended {
+		result := g.resultJSON()
+		g.You.emit("game:result", result)
+		g.Opponent.emit("game:result", result)
+	}
+
+	for _, s := range g.spectators {
+		g.emitSpectator(s, fen)
+	}
+
+	disconnected := 0
+	for _, p := range []*Player{g.You, g.Opponent} {
+		if p.conn == nil {
+			disconnected++
+		}
+	}
+
+	return disconnected
+}
 
-	g.You.s.Emit("game:end-state", g.endState)
-	g.Opponent.s.Emit("game:end-state", g.endState)
+// resultJSON returns the game:result data sent to both players once the game has ended
+func (g *GameController) resultJSON() string {
+	data, _ := json.Marshal(struct {
+		EndState string             `json:"endState"`
+		Result   string             `json:"result"`
+		Winner   string             `json:"winner"`
+		Rated    bool               `json:"rated"`
+		Ratings  *ratingChangesJSON `json:"ratings,omitempty"`
+	}{g.endState, g.Result(), ColorName(g.winner), g.rated, g.ratingChangesJSON()})
+
+	return string(data)
+}
+
+type playerJSON struct {
+	Username string  `json:"username"`
+	Time     int64   `json:"time"`
+	Running  bool    `json:"running"`
+	Score    float64 `json:"score"`
+	Lag      int64   `json:"lag"`
+}
+
+func (g *GameController) newPlayerJSON(p *Player) playerJSON {
+	return playerJSON{p.name, durationToMillis(p.TimeLeft()), p.clock != nil && p.clock.Running(), g.matchScore(p), durationToMillis(p.lag.RTT())}
+}
+
+type timeControlStageJSON struct {
+	Moves     int   `json:"moves"`
+	Time      int64 `json:"time"`
+	Increment int64 `json:"increment"`
+}
+
+type timeControlJSON struct {
+	PGN         string                 `json:"pgn"`
+	Delay       string                 `json:"delay"`
+	Mode        string                 `json:"mode"`
+	Stages      []timeControlStageJSON `json:"stages"`
+	BlackStages []timeControlStageJSON `json:"blackStages,omitempty"`
+}
+
+func newTimeControlStagesJSON(stages []TimeControlStage) []timeControlStageJSON {
+	var data []timeControlStageJSON
+	for _, stage := range stages {
+		data = append(data, timeControlStageJSON{stage.Moves, durationToMillis(stage.Time), durationToMillis(stage.Increment)})
+	}
+
+	return data
+}
+
+// playersJSON returns the game:players data from the perspective of you, all times are in milliseconds
+// and serverTime is when the data was sent so clients can tick running clocks from an accurate starting point
+func (g *GameController) playersJSON(you, opponent *Player) string {
+	tc := timeControlJSON{
+		PGN:         g.timeControl.String(),
+		Delay:       g.timeControl.DelayName(),
+		Mode:        g.timeControl.ModeName(),
+		Stages:      newTimeControlStagesJSON(g.timeControl.Stages),
+		BlackStages: newTimeControlStagesJSON(g.timeControl.BlackStages),
+	}
+
+	data, _ := json.Marshal(struct {
+		You         playerJSON      `json:"you"`
+		Opponent    playerJSON      `json:"opponent"`
+		TimeControl timeControlJSON `json:"timeControl"`
+		ServerTime  int64           `json:"serverTime"`
+	}{
+		g.newPlayerJSON(you),
+		g.newPlayerJSON(opponent),
+		tc,
+		unixMillis(time.Now()),
+	})
+
+	return string(data)
 }
 
 func (g *GameController) toFENString() string {
@@ -360,19 +1103,17 @@ func (g *GameController) locationToFileAndRank(loc string) (int, int) {
 }
 
 func (g *GameController) fileAndRankToLocation(file, rank int) string {
-	return string('a'+file) + string('0'+(8-rank))
+	return string(rune('a'+file)) + string(rune('0'+(8-rank)))
 }
 
 // NextTurn performs end game state checks and if game does not end then proceeds to next turn
 func (g *GameController) NextTurn(color int, opponentColor int) {
 	// check for winning conditions
 	if g.board.IsStalemate(opponentColor, color) {
-		g.ended = true
-
 		if g.board.IsKingInCheck(opponentColor, color) {
-			g.endState = "checkmate"
+			g.end(EndCheckmate, color)
 		} else {
-			g.endState = "stalemate"
+			g.end(EndStalemate, Draw)
 		}
 
 		return
@@ -386,7 +1127,7 @@ func (g *GameController) NextTurn(color int, opponentColor int) {
 		g.turn = Black
 	}
 
-	if g.fullmoves == 50 {
-		g.ended = true
+	if g.fullmoves == MoveLimit {
+		g.end(EndMoveLimit, Draw)
 	}
 }
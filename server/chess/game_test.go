@@ -0,0 +1,176 @@
+package chess
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConnection records the events sent to it
+type fakeConnection struct {
+	id string
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (conn *fakeConnection) ID() string {
+	return conn.id
+}
+
+func (conn *fakeConnection) Emit(event string, args ...interface{}) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	conn.events = append(conn.events, event)
+}
+
+func (conn *fakeConnection) Close() error {
+	return nil
+}
+
+// newTestGame starts a game with the time control pgn between white and black on fake connections
+func newTestGame(t *testing.T, pgn string) (*GameController, *fakeConnection, *fakeConnection) {
+	tc, err := ParseTimeControl(pgn, "fischer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	white, black := &fakeConnection{id: "white"}, &fakeConnection{id: "black"}
+
+	g := NewGame("test", tc)
+	g.You = NewPlayer("white", White, false, white)
+	g.Opponent = NewPlayer("black", Black, true, black)
+	g.StartGame()
+	t.Cleanup(g.Stop)
+
+	return g, white, black
+}
+
+// waitForEnd waits for g to end, failing the test if it hasn't ended within timeout
+func waitForEnd(t *testing.T, g *GameController, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for !g.IsEnded() {
+		if time.Now().After(deadline) {
+			t.Fatal("game didn't end")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestConcurrentMovesBroadcastsAndFlag has both players shuffle their knights, while the game is broadcast
+// and queried, until the game ends on time or by the move limit
+func TestConcurrentMovesBroadcastsAndFlag(t *testing.T) {
+	g, _, _ := newTestGame(t, "0.5")
+
+	// knight moves from and to as file, rank, dFile, dRank
+	shuffles := map[string][][4]int{
+		"white": {{6, 7, 5, 5}, {5, 5, 6, 7}},
+		"black": {{1, 0, 2, 2}, {2, 2, 1, 0}},
+	}
+
+	var wg sync.WaitGroup
+	for id, moves := range shuffles {
+		wg.Add(1)
+		go func(id string, moves [][4]int) {
+			defer wg.Done()
+
+			for i := 0; !g.IsEnded(); {
+				m := moves[i%len(moves)]
+				if g.MakePlayerMove(id, m[0], m[1], m[2], m[3], 0) {
+					i++
+				}
+			}
+		}(id, moves)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for !g.IsEnded() {
+			g.BroadcastData()
+			g.GetPlayerValidMoves("white", 6, 7)
+			g.Pong("black", 0)
+			g.Snapshot()
+		}
+	}()
+
+	waitForEnd(t, g, 5*time.Second)
+	wg.Wait()
+
+	if state := g.EndState(); state != EndTimeout && state != EndMoveLimit {
+		t.Fatalf("game ended by %q, want %q or %q", state, EndTimeout, EndMoveLimit)
+	}
+}
+
+// TestFlagFallsDuringBroadcasts checks the flag timer ends the game while it is being broadcast
+func TestFlagFallsDuringBroadcasts(t *testing.T) {
+	g, white, _ := newTestGame(t, "0.05")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for !g.IsEnded() {
+			g.BroadcastData()
+		}
+	}()
+
+	waitForEnd(t, g, 5*time.Second)
+	<-done
+
+	if state, winner := g.EndState(), g.Winner(); state != EndTimeout || winner != Black {
+		t.Fatalf("game ended by %q won by %d, want %q won by black", state, winner, EndTimeout)
+	}
+	if g.MakePlayerMove(white.ID(), 6, 7, 5, 5, 0) {
+		t.Fatal("move was made after the game ended")
+	}
+}
+
+// TestPauseRejectsMoves checks a paused game doesn't accept moves until it is resumed
+func TestPauseRejectsMoves(t *testing.T) {
+	g, white, _ := newTestGame(t, "60")
+
+	g.Pause()
+	if g.MakePlayerMove(white.ID(), 6, 7, 5, 5, 0) {
+		t.Fatal("move was made while the game was paused")
+	}
+
+	g.Resume()
+	if !g.MakePlayerMove(white.ID(), 6, 7, 5, 5, 0) {
+		t.Fatal("move wasn't made after the game was resumed")
+	}
+}
+
+// TestOnEndCalledWhenGameEnds checks the OnEnd function has been called by the time the game has ended
+func TestOnEndCalledWhenGameEnds(t *testing.T) {
+	g, white, _ := newTestGame(t, "60")
+
+	ended := 0
+	g.OnEnd(func(g *GameController) {
+		ended++
+	})
+
+	g.Leave(white.ID())
+	if ended != 1 {
+		t.Fatalf("OnEnd was called %d times, want 1", ended)
+	}
+}
+
+// TestWatchPrivateRoom checks rooms with a password or a reserved seat can't be watched
+func TestWatchPrivateRoom(t *testing.T) {
+	g := NewGame("test", DefaultTimeControl())
+	if err := g.Watch(&fakeConnection{id: "spectator"}, "spectator"); err != nil {
+		t.Fatalf("failed to watch a public room: %v", err)
+	}
+
+	g = NewGame("test", DefaultTimeControl())
+	g.ReserveSeat("friend")
+	if err := g.Watch(&fakeConnection{id: "spectator"}, "spectator"); err != ErrPrivateRoom {
+		t.Fatalf("watching a reserved room returned %v, want %v", err, ErrPrivateRoom)
+	}
+	if spectators := g.Spectators(); spectators != 0 {
+		t.Fatalf("reserved room has %d spectators, want 0", spectators)
+	}
+}
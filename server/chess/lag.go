@@ -0,0 +1,84 @@
+package chess
+
+import "time"
+
+const (
+	// pingInterval is how often players are pinged to measure their latency
+	pingInterval = 5 * time.Second
+	// maxPings is how many unanswered pings are remembered per player
+	maxPings = 4
+
+	// lagQuotaGain is the compensation a player earns with every move
+	lagQuotaGain = 100 * time.Millisecond
+	// lagQuotaMax is the most compensation a player can save up
+	lagQuotaMax = 500 * time.Millisecond
+	// lagCompensationMax is the most compensation given for a single move
+	lagCompensationMax = time.Second
+)
+
+// LagTracker measures the round trip time of a player's connection and decides
+// how much of it to credit back when they move, based on Lichess' lag quota
+type LagTracker struct {
+	rtt      time.Duration
+	measured bool
+	quota    time.Duration
+
+	pings    map[int]time.Time
+	nextPing int
+}
+
+// NewLagTracker creates a lag tracker with a full quota
+func NewLagTracker() *LagTracker {
+	return &LagTracker{quota: lagQuotaMax, pings: make(map[int]time.Time)}
+}
+
+// Ping records that a ping is being sent and returns its id
+func (l *LagTracker) Ping() int {
+	id := l.nextPing
+	l.nextPing++
+
+	l.pings[id] = time.Now()
+	delete(l.pings, id-maxPings)
+
+	return id
+}
+
+// Pong records the reply to the ping with id
+// @returns wether the pong matched an outstanding ping
+func (l *LagTracker) Pong(id int) bool {
+	sent, exists := l.pings[id]
+	if !exists {
+		return false
+	}
+	delete(l.pings, id)
+
+	rtt := time.Since(sent)
+	if !l.measured {
+		l.rtt = rtt
+		l.measured = true
+	} else {
+		// weighted moving average so a single slow ping doesn't swing the estimate
+		l.rtt = (l.rtt*3 + rtt) / 4
+	}
+
+	return true
+}
+
+// RTT returns the average round trip time of the player's connection
+func (l *LagTracker) RTT() time.Duration {
+	return l.rtt
+}
+
+// Compensation returns how much time would be credited back for the player's next move
+func (l *LagTracker) Compensation() time.Duration {
+	return minDuration(minDuration(l.rtt/2, l.quota), lagCompensationMax)
+}
+
+// compensate uses the player's quota to credit back the transit time of a move that took spent
+// @returns the time to add back to the player's clock
+func (l *LagTracker) compensate(spent time.Duration) time.Duration {
+	credit := minDuration(l.Compensation(), spent)
+	l.quota = minDuration(l.quota-credit+lagQuotaGain, lagQuotaMax)
+
+	return credit
+}
@@ -0,0 +1,96 @@
+package chess
+
+var pieceLetters = map[int]string{
+	Queen:  "Q",
+	King:   "K",
+	Rook:   "R",
+	Bishop: "B",
+	Knight: "N",
+}
+
+// sanPrefix returns the standard algebraic notation of moving the piece on start to dest, without
+// the check suffix. It must be called before the move is played since it looks at the pieces
+// that could also have moved to dest
+func (g *GameController) sanPrefix(start, dest *Spot, castlingRights *CastlingRights) string {
+	piece := start.piece
+	to := g.fileAndRankToLocation(dest.file, dest.rank)
+	capture := dest.containsPiece
+
+	switch piece.class {
+	case King:
+		if dest.file-start.file == 2 {
+			return "O-O"
+		} else if start.file-dest.file == 2 {
+			return "O-O-O"
+		}
+	case Pawn:
+		// pawns only change file when they capture, this also covers en passant
+		if start.file != dest.file {
+			return g.fileAndRankToLocation(start.file, start.rank)[:1] + "x" + to
+		}
+
+		return to
+	}
+
+	san := pieceLetters[piece.class] + g.disambiguate(start, dest, castlingRights)
+	if capture {
+		san += "x"
+	}
+
+	return san + to
+}
+
+// disambiguate returns the file, rank or both of start when another piece of the same class
+// and color could also move to dest
+func (g *GameController) disambiguate(start, dest *Spot, castlingRights *CastlingRights) string {
+	sameFile, sameRank, ambiguous := false, false, false
+
+	for rank := 0; rank < Size; rank++ {
+		for file := 0; file < Size; file++ {
+			s := &g.board.grid[file][rank]
+			if s == start || !s.containsPiece || s.piece.color != start.piece.color || s.piece.class != start.piece.class {
+				continue
+			}
+
+			for _, m := range g.board.GetValidMoves(s, g.GetOpponentColor(start.piece.color), castlingRights) {
+				if m.file == dest.file && m.rank == dest.rank {
+					ambiguous = true
+					sameFile = sameFile || file == start.file
+					sameRank = sameRank || rank == start.rank
+				}
+			}
+		}
+	}
+
+	location := g.fileAndRankToLocation(start.file, start.rank)
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return location[:1]
+	case !sameRank:
+		return location[1:]
+	default:
+		return location
+	}
+}
+
+// sanSuffix returns the promotion and check or checkmate markers of the move that has just been
+// played to dest by color
+func (g *GameController) sanSuffix(dest *Spot, color int, promoted bool) string {
+	suffix := ""
+	if promoted {
+		suffix += "=" + pieceLetters[dest.piece.class]
+	}
+
+	opponentColor := g.GetOpponentColor(color)
+	if g.board.IsKingInCheck(opponentColor, color) {
+		if g.board.IsStalemate(opponentColor, color) {
+			suffix += "#"
+		} else {
+			suffix += "+"
+		}
+	}
+
+	return suffix
+}
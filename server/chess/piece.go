@@ -1,7 +1,5 @@
 package chess
 
-import "log"
-
 // Enum type of piece
 const (
 	Queen int = iota
@@ -110,7 +108,6 @@ func (p *Piece) FindValidMoves(b *Board, file int, rank int, opponentColor int,
 		// log.Printf("start: %d, i: %d, move: (%d, %d) \n", len(validMoves), i, validMoves[i].file, validMoves[i].rank)
 
 		if p.PruneMove(b, file, rank, validMoves[i].file, validMoves[i].rank) {
-			log.Printf("check pruned: (%d, %d) \n", validMoves[i].file, validMoves[i].rank)
 			// remove move
 			validMoves = append(validMoves[:i], validMoves[i+1:]...)
 		}
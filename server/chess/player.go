@@ -1,24 +1,113 @@
 package chess
 
-import socketio "github.com/googollee/go-socket.io"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
 
-// User stores name and time of user
+// User stores name and clock of user
 type Player struct {
-	name           string
-	time           int
-	timeOfLastMove int
-	opponent       bool
-	s              socketio.Conn
+	name     string
+	color    int
+	clock    *Clock
+	lag      *LagTracker
+	opponent bool
+	conn     Connection
+
+	// account is the username of the registered account playing, empty for guests
+	account string
+
+	// key is the secret the player uses to reopen the game from a new connection
+	key string
+	// matchScore is the points the player scored in the earlier games of a rematch series
+	matchScore float64
+	// offeredRematch is set once the player has offered their opponent a rematch
+	offeredRematch bool
+
+	// mutedOpponent stops the opponent's chat messages being sent to the player
+	mutedOpponent bool
+
+	// disconnectedAt is when the player's connection disconnected, zero while they are connected
+	disconnectedAt time.Time
+
+	// time control stage the player is in and the moves they have made in it
+	stage      int
+	stageMoves int
+}
+
+// Name returns the player's username
+func (p *Player) Name() string {
+	return p.name
+}
+
+// Account returns the username of the account playing, empty if the player is a guest
+func (p *Player) Account() string {
+	return p.account
+}
+
+// SetAccount binds a registered account to the player, they play under the account's username
+func (p *Player) SetAccount(username string) {
+	p.account = username
+	p.name = username
 }
 
 func (p *Player) CompareID(id string) bool {
-	return p.s.ID() == id
+	return p != nil && p.conn != nil && p.conn.ID() == id
+}
+
+// TimeLeft returns the time left on the player's clock, 0 before the game has started
+func (p *Player) TimeLeft() time.Duration {
+	if p.clock == nil {
+		return 0
+	}
+
+	return p.clock.Remaining()
 }
 
-func (p *Player) GetSocket() socketio.Conn {
-	return p.s
+// Connection returns the connection the player is sent the game's events on, nil while they are disconnected
+func (p *Player) Connection() Connection {
+	return p.conn
 }
 
-func NewPlayer(name string, opponent bool, s socketio.Conn) *Player {
-	return &Player{name, 600000, 0, opponent, s}
+// SetConnection binds the player to a new connection, conn is nil while the player is disconnected
+func (p *Player) SetConnection(conn Connection) {
+	p.conn = conn
+}
+
+// Key returns the secret the player uses to reopen the game
+func (p *Player) Key() string {
+	return p.key
+}
+
+// Color returns the color the player plays
+func (p *Player) Color() int {
+	return p.color
+}
+
+// IsOpponent returns true if the player joined the game rather than created it
+func (p *Player) IsOpponent() bool {
+	return p.opponent
+}
+
+// emit sends an event to the player if they exist and are connected
+func (p *Player) emit(event string, args ...interface{}) {
+	if p != nil && p.conn != nil {
+		p.conn.Emit(event, args...)
+	}
+}
+
+// NewPlayer creates a player of color, their clock is set from the game's time control when the game starts.
+// The opponent is the player who joined the game rather than created it
+func NewPlayer(name string, color int, opponent bool, conn Connection) *Player {
+	return &Player{name: name, color: color, lag: NewLagTracker(), opponent: opponent, conn: conn, key: newKey()}
+}
+
+func newKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
 }
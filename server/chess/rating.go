@@ -0,0 +1,47 @@
+package chess
+
+// RatingChange is a player's rating after a rated game and how much it changed by
+type RatingChange struct {
+	Rating      int  `json:"rating"`
+	Change      int  `json:"change"`
+	Provisional bool `json:"provisional"`
+}
+
+type ratingChangesJSON struct {
+	White *RatingChange `json:"white"`
+	Black *RatingChange `json:"black"`
+}
+
+// SetRated sets wether the game changes the players' ratings, it should be set before the game starts
+func (g *GameController) SetRated(rated bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.rated = rated
+}
+
+// IsRated returns true if the game changes the players' ratings
+func (g *GameController) IsRated() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.rated
+}
+
+// SetRatingChanges records how the players' ratings changed once the game has been rated,
+// they are sent with game:result
+func (g *GameController) SetRatingChanges(white, black RatingChange) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.ratingChanges[White] = &white
+	g.ratingChanges[Black] = &black
+}
+
+func (g *GameController) ratingChangesJSON() *ratingChangesJSON {
+	if g.ratingChanges[White] == nil {
+		return nil
+	}
+
+	return &ratingChangesJSON{g.ratingChanges[White], g.ratingChanges[Black]}
+}
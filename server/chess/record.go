@@ -0,0 +1,155 @@
+package chess
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pgnLineLength is the longest a line of PGN movetext should be
+const pgnLineLength = 80
+
+// GameRecord is a finished game as it is archived
+type GameRecord struct {
+	ID          string        `json:"id"`
+	Code        string        `json:"code"`
+	Variant     string        `json:"variant"`
+	White       PlayerRecord  `json:"white"`
+	Black       PlayerRecord  `json:"black"`
+	Result      string        `json:"result"`
+	EndState    string        `json:"endState"`
+	Winner      string        `json:"winner"`
+	TimeControl string        `json:"timeControl"`
+	Delay       string        `json:"delay"`
+	Mode        string        `json:"mode"`
+	Category    string        `json:"category"`
+	Rated       bool          `json:"rated"`
+	Moves       []string      `json:"moves"`
+	Chat        []ChatMessage `json:"chat,omitempty"`
+	PGN         string        `json:"pgn"`
+	StartedAt   time.Time     `json:"startedAt"`
+	EndedAt     time.Time     `json:"endedAt"`
+
+	// Private is set when the room had a password or a reserved seat
+	Private bool `json:"private"`
+}
+
+// PlayerRecord is a player of an archived game, Account is empty for guests
+type PlayerRecord struct {
+	Name    string `json:"name"`
+	Account string `json:"account,omitempty"`
+}
+
+// Record returns the game as it should be archived, nil if the game hasn't finished
+func (g *GameController) Record() *GameRecord {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	white, black := g.playerOfColor(White), g.playerOfColor(Black)
+	if !g.started || !g.ended || white == nil || black == nil {
+		return nil
+	}
+
+	moves := make([]string, len(g.moves))
+	for i, m := range g.moves {
+		moves[i] = m.SAN
+	}
+
+	return &GameRecord{
+		// ids sort in the order games ended
+		ID:          fmt.Sprintf("%020d-%s", g.endTime.UnixNano(), g.code),
+		Code:        g.code,
+		Variant:     g.Variant(),
+		White:       PlayerRecord{white.name, white.account},
+		Black:       PlayerRecord{black.name, black.account},
+		Result:      g.Result(),
+		EndState:    g.endState,
+		Winner:      ColorName(g.winner),
+		TimeControl: g.timeControl.String(),
+		Delay:       g.timeControl.DelayName(),
+		Mode:        g.timeControl.ModeName(),
+		Category:    g.timeControl.Category(),
+		Rated:       g.rated,
+		Moves:       moves,
+		Chat:        append([]ChatMessage{}, g.chat...),
+		PGN:         g.pgn(),
+		StartedAt:   g.startTime,
+		EndedAt:     g.endTime,
+		Private:     g.isPrivate(),
+	}
+}
+
+// ColorName returns "white" or "black" for a color, empty for anything else such as Draw
+func ColorName(color int) string {
+	switch color {
+	case White:
+		return "white"
+	case Black:
+		return "black"
+	}
+
+	return ""
+}
+
+// pgn returns the game in Portable Game Notation
+func (g *GameController) pgn() string {
+	var b strings.Builder
+
+	tags := [][2]string{
+		{"Event", "Scuffed Chess game"},
+		{"Site", "scuffedchess.online"},
+		{"Date", g.startTime.UTC().Format("2006.01.02")},
+		{"Round", "-"},
+		{"White", g.playerOfColor(White).name},
+		{"Black", g.playerOfColor(Black).name},
+		{"Result", g.Result()},
+		{"Variant", g.Variant()},
+		{"TimeControl", g.timeControl.String()},
+		{"Termination", termination(g.endState)},
+	}
+	for _, tag := range tags {
+		fmt.Fprintf(&b, "[%s \"%s\"]\n", tag[0], pgnEscape(tag[1]))
+	}
+	b.WriteString("\n")
+
+	line := 0
+	write := func(token string) {
+		if line > 0 && line+1+len(token) > pgnLineLength {
+			b.WriteString("\n")
+			line = 0
+		} else if line > 0 {
+			b.WriteString(" ")
+			line++
+		}
+
+		b.WriteString(token)
+		line += len(token)
+	}
+
+	for i, m := range g.moves {
+		if i%2 == 0 {
+			write(fmt.Sprintf("%d.", i/2+1))
+		}
+		write(m.SAN)
+	}
+	write(g.Result())
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// termination returns the PGN Termination tag for an end state
+func termination(endState string) string {
+	switch endState {
+	case EndTimeout:
+		return "time forfeit"
+	case EndAbandoned, EndDisconnect:
+		return "abandoned"
+	}
+
+	return "normal"
+}
+
+func pgnEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,121 @@
+package chess
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var ErrGameNotEnded = errors.New("the game hasn't ended")
+var ErrNoRematchOffer = errors.New("the opponent hasn't offered a rematch")
+var ErrOpponentDisconnected = errors.New("the opponent has disconnected")
+
+// OfferRematch offers the opponent of the player on the connection with id a rematch once the game has ended,
+// the opponent is sent game:rematch-offered
+// @returns true if the opponent had already offered a rematch, so the rematch should start
+func (g *GameController) OfferRematch(id string) (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.playerWithID(id)
+	if p == nil {
+		return false, ErrNotInGame
+	} else if !g.ended {
+		return false, ErrGameNotEnded
+	}
+
+	opponent := g.opponentOf(p)
+	if opponent == nil {
+		return false, ErrNotInGame
+	} else if opponent.conn == nil {
+		return false, ErrOpponentDisconnected
+	}
+
+	p.offeredRematch = true
+	if opponent.offeredRematch {
+		return true, nil
+	}
+
+	opponent.emit("game:rematch-offered")
+	return false, nil
+}
+
+// AcceptRematch checks the opponent of the player on the connection with id has offered them a rematch
+func (g *GameController) AcceptRematch(id string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p := g.playerWithID(id)
+	if p == nil {
+		return ErrNotInGame
+	} else if !g.ended {
+		return ErrGameNotEnded
+	}
+
+	opponent := g.opponentOf(p)
+	if opponent == nil || !opponent.offeredRematch {
+		return ErrNoRematchOffer
+	} else if opponent.conn == nil {
+		return ErrOpponentDisconnected
+	}
+
+	return nil
+}
+
+// Rematch creates a game with code between the same players, with the same time control and variant,
+// where the players have swapped colors. The players' connections and match scores move to the new game and
+// the spectators are sent game:rematch with the new code so they can follow it. The new game isn't started
+// @returns nil if the rematch has already been created or a player has disconnected, they would have no
+// way to rejoin the rematch
+func (g *GameController) Rematch(code string) *GameController {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.rematched || g.You == nil || g.Opponent == nil || g.You.conn == nil || g.Opponent.conn == nil {
+		return nil
+	}
+	g.rematched = true
+
+	rematch := NewGame(code, g.timeControl)
+	rematch.rated = g.rated
+	rematch.onEnd = g.onEnd
+
+	rematch.You = g.rematchPlayer(g.You)
+	rematch.Opponent = g.rematchPlayer(g.Opponent)
+
+	data, _ := json.Marshal(struct {
+		Code string `json:"code"`
+	}{code})
+	for _, s := range g.spectators {
+		s.emit("game:rematch", string(data))
+	}
+
+	return rematch
+}
+
+// rematchPlayer returns p's seat in the rematch playing the other color, they keep their connection,
+// account and lag measurements
+func (g *GameController) rematchPlayer(p *Player) *Player {
+	next := NewPlayer(p.name, g.GetOpponentColor(p.color), p.opponent, p.conn)
+	next.account = p.account
+	next.lag = p.lag
+	next.mutedOpponent = p.mutedOpponent
+	next.matchScore = g.matchScore(p)
+
+	return next
+}
+
+// matchScore returns the points p has scored in their rematch series, including this game once it has ended
+func (g *GameController) matchScore(p *Player) float64 {
+	if !g.ended {
+		return p.matchScore
+	}
+
+	switch g.winner {
+	case Draw:
+		return p.matchScore + 0.5
+	case g.colorOf(p):
+		return p.matchScore + 1
+	}
+
+	return p.matchScore
+}
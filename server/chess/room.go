@@ -0,0 +1,117 @@
+package chess
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxRoomPasswordLength is the longest a room password can be, bcrypt only uses the first 72 bytes
+const MaxRoomPasswordLength = 72
+
+// errors a player can be refused the open seat with
+var (
+	ErrGameFull            = errors.New("game already has two players")
+	ErrWrongPassword       = errors.New("wrong room password")
+	ErrSeatReserved        = errors.New("seat is reserved for another player")
+	ErrInviteUsed          = errors.New("invite has already been used")
+	ErrNotCreator          = errors.New("only the game's creator can invite players")
+	ErrRoomPasswordTooLong = errors.New("room passwords can be at most 72 characters")
+	ErrPrivateRoom         = errors.New("private rooms can't be watched")
+)
+
+// SetPassword makes the open seat only joinable with password or an invite, an empty password removes it
+func (g *GameController) SetPassword(password string) error {
+	if len(password) > MaxRoomPasswordLength {
+		return ErrRoomPasswordTooLong
+	}
+
+	var hash []byte
+	if password != "" {
+		var err error
+		if hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.password = hash
+	return nil
+}
+
+// isPrivate returns true if the room has a password or its open seat is reserved, private rooms can't be
+// watched and aren't listed in the archive
+func (g *GameController) isPrivate() bool {
+	return g.password != nil || g.reservedFor != ""
+}
+
+// ReserveSeat restricts the open seat to the registered player with account, empty lets anyone join
+func (g *GameController) ReserveSeat(account string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.reservedFor = account
+}
+
+// Invite creates a single use invite to the open seat, only the creator of the game can invite players
+// @returns the invite's key, which is sent to the invited player signed so it can't be forged
+func (g *GameController) Invite(id string) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.You == nil || !g.You.CompareID(id) {
+		return "", ErrNotCreator
+	} else if g.Opponent != nil || g.started {
+		return "", ErrGameFull
+	}
+
+	if g.invites == nil {
+		g.invites = make(map[string]bool)
+	}
+
+	key := newKey()
+	g.invites[key] = true
+	return key, nil
+}
+
+// checkSeat returns why p can't take the open seat with the invite with key, nil if they might. Without an
+// invite they also need the room's password, it is checked separately by checkPassword as bcrypt is slow.
+// An invite stands in for the password but not for a reserved seat
+func (g *GameController) checkSeat(p *Player, invite string) error {
+	if g.Opponent != nil || g.You == nil || g.started {
+		return ErrGameFull
+	}
+
+	if g.reservedFor != "" && !strings.EqualFold(p.account, g.reservedFor) {
+		return ErrSeatReserved
+	}
+
+	if invite != "" && !g.invites[invite] {
+		return ErrInviteUsed
+	}
+
+	return nil
+}
+
+// checkPassword returns ErrWrongPassword if password doesn't match the room password's hash, nil if it
+// does or there is no password. It doesn't need the game's lock
+func checkPassword(hash []byte, password string) error {
+	if hash != nil && bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+
+	return nil
+}
+
+// inviteKeys returns the keys of the invites that haven't been used yet
+func (g *GameController) inviteKeys() []string {
+	keys := make([]string, 0, len(g.invites))
+	for key := range g.invites {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
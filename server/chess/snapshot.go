@@ -0,0 +1,195 @@
+package chess
+
+import (
+	"fmt"
+	"time"
+)
+
+// GameSnapshot is the state of a game saved so it can be restored after the server restarts
+type GameSnapshot struct {
+	Code             string          `json:"code"`
+	Variant          string          `json:"variant"`
+	TimeControl      string          `json:"timeControl"`
+	Delay            string          `json:"delay"`
+	TimeMode         string          `json:"timeMode"`
+	BlackTimeControl string          `json:"blackTimeControl,omitempty"`
+	Moves            []Move          `json:"moves"`
+	Rated            bool            `json:"rated"`
+	Chat             []ChatMessage   `json:"chat"`
+	Started          bool            `json:"started"`
+	StartTime        time.Time       `json:"startTime"`
+	EndTime          time.Time       `json:"endTime"`
+	Ended            bool            `json:"ended"`
+	EndState         string          `json:"endState"`
+	Winner           int             `json:"winner"`
+	You              *PlayerSnapshot `json:"you"`
+	Opponent         *PlayerSnapshot `json:"opponent,omitempty"`
+	Password         []byte          `json:"password,omitempty"`
+	ReservedFor      string          `json:"reservedFor,omitempty"`
+	Invites          []string        `json:"invites,omitempty"`
+	SavedAt          time.Time       `json:"savedAt"`
+}
+
+// PlayerSnapshot is the state of a player saved with their game
+type PlayerSnapshot struct {
+	Name       string        `json:"name"`
+	Account    string        `json:"account,omitempty"`
+	Color      string        `json:"color"`
+	Key        string        `json:"key"`
+	Opponent   bool          `json:"opponent"`
+	Time       time.Duration `json:"time"`
+	Stage      int           `json:"stage"`
+	StageMoves int           `json:"stageMoves"`
+
+	MutedOpponent bool    `json:"mutedOpponent"`
+	MatchScore    float64 `json:"matchScore"`
+}
+
+// Snapshot returns the current state of the game
+func (g *GameController) Snapshot() *GameSnapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := &GameSnapshot{
+		Code:        g.code,
+		Variant:     g.Variant(),
+		TimeControl: g.timeControl.String(),
+		Delay:       g.timeControl.DelayName(),
+		TimeMode:    g.timeControl.ModeName(),
+		Moves:       append([]Move{}, g.moves...),
+		Rated:       g.rated,
+		Chat:        append([]ChatMessage{}, g.chat...),
+		Started:     g.started,
+		StartTime:   g.startTime,
+		EndTime:     g.endTime,
+		Ended:       g.ended,
+		EndState:    g.endState,
+		Winner:      g.winner,
+		You:         snapshotPlayer(g.You),
+		Opponent:    snapshotPlayer(g.Opponent),
+		Password:    g.password,
+		ReservedFor: g.reservedFor,
+		Invites:     g.inviteKeys(),
+		SavedAt:     time.Now(),
+	}
+
+	if g.timeControl.Mode == Armageddon {
+		s.BlackTimeControl = g.timeControl.BlackString()
+	}
+
+	return s
+}
+
+func snapshotPlayer(p *Player) *PlayerSnapshot {
+	if p == nil {
+		return nil
+	}
+
+	return &PlayerSnapshot{p.name, p.account, ColorName(p.color), p.key, p.opponent, p.TimeLeft(), p.stage, p.stageMoves, p.mutedOpponent, p.matchScore}
+}
+
+// RestoreGame recreates a game from a snapshot by replaying its moves, players are disconnected until
+// they reopen the game. Correspondence clocks keep running while the server is down, live games aren't
+// charged for the downtime and stay paused until both players have reopened them
+func RestoreGame(s *GameSnapshot) (*GameController, error) {
+	if s.Variant != "" && s.Variant != VariantStandard {
+		return nil, fmt.Errorf("game %s is played in unknown variant %s", s.Code, s.Variant)
+	}
+
+	tc, err := ParseTimeControl(s.TimeControl, s.Delay)
+	if err != nil {
+		return nil, err
+	}
+	if err := tc.SetMode(s.TimeMode, s.BlackTimeControl); err != nil {
+		return nil, err
+	}
+
+	g := NewGame(s.Code, tc)
+	g.You = restorePlayer(s.You)
+	g.Opponent = restorePlayer(s.Opponent)
+
+	for i, m := range s.Moves {
+		if !g.playMove(m.File, m.Rank, m.DFile, m.DRank, m.Promotion) {
+			return nil, fmt.Errorf("move %d of game %s can't be replayed", i+1, s.Code)
+		}
+		g.NextTurn(g.turn, g.GetOpponentColor(g.turn))
+	}
+
+	g.rated = s.Rated
+	g.chat = s.Chat
+	g.started = s.Started
+	g.startTime = s.StartTime
+	g.endTime = s.EndTime
+	g.ended = s.Ended
+	g.endState = s.EndState
+	g.winner = s.Winner
+	g.password = s.Password
+	g.reservedFor = s.ReservedFor
+
+	for _, key := range s.Invites {
+		if g.invites == nil {
+			g.invites = make(map[string]bool)
+		}
+		g.invites[key] = true
+	}
+
+	if g.started && !g.ended {
+		if g.You == nil || g.Opponent == nil {
+			return nil, fmt.Errorf("game %s has started without both players", s.Code)
+		}
+
+		// the timers lock the game when they fire so it is locked while they are started
+		g.mu.Lock()
+		g.startTimers()
+		if tc.Mode == Correspondence {
+			g.CurrentlyPlaying().clock.Add(-time.Since(s.SavedAt))
+			g.scheduleFlag()
+		} else {
+			g.pause()
+		}
+		g.mu.Unlock()
+	}
+
+	return g, nil
+}
+
+// restoreColor returns the color of a saved player, players saved before colors could be chosen
+// played white if they created the game
+func restoreColor(s *PlayerSnapshot) int {
+	switch s.Color {
+	case "white":
+		return White
+	case "black":
+		return Black
+	}
+
+	if s.Opponent {
+		return Black
+	}
+
+	return White
+}
+
+func restorePlayer(s *PlayerSnapshot) *Player {
+	if s == nil {
+		return nil
+	}
+
+	return &Player{
+		name:       s.Name,
+		account:    s.Account,
+		color:      restoreColor(s),
+		clock:      NewClock(s.Time),
+		lag:        NewLagTracker(),
+		opponent:   s.Opponent,
+		key:        s.Key,
+		stage:      s.Stage,
+		stageMoves: s.StageMoves,
+
+		mutedOpponent: s.MutedOpponent,
+		matchScore:    s.MatchScore,
+
+		// restored players have no connection until they rejoin
+		disconnectedAt: time.Now(),
+	}
+}
@@ -0,0 +1,75 @@
+package chess
+
+import "encoding/json"
+
+// spectator is a connection watching a game, name is shown on its chat messages
+type spectator struct {
+	conn Connection
+	name string
+}
+
+func (s *spectator) emit(event string, args ...interface{}) {
+	s.conn.Emit(event, args...)
+}
+
+// Watch subscribes conn to the game as a read-only spectator and sends it the current state of the game
+// and the spectators' chat, spectators receive the same updates as the players but can't move for either color.
+// Rooms with a password or a reserved seat can't be watched, knowing their code isn't enough
+// @returns ErrPrivateRoom if the room is private, nil if conn is watching
+func (g *GameController) Watch(conn Connection, name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.isPrivate() {
+		return ErrPrivateRoom
+	}
+
+	spec := &spectator{conn, name}
+	g.spectators[conn.ID()] = spec
+	g.emitSpectator(spec, g.toFENString())
+	spec.emit("game:chat-history", g.chatHistoryJSON(ChannelSpectators))
+	return nil
+}
+
+// Unwatch unsubscribes the spectator on the connection with id
+// @returns wether the connection was watching the game
+func (g *GameController) Unwatch(id string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, watching := g.spectators[id]; !watching {
+		return false
+	}
+
+	delete(g.spectators, id)
+	return true
+}
+
+// Spectators returns the number of connections watching the game
+func (g *GameController) Spectators() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return len(g.spectators)
+}
+
+// emitSpectator sends the state of the game to a spectator, players are sent from white's perspective
+func (g *GameController) emitSpectator(s *spectator, fen string) {
+	s.emit("game:fen", fen)
+	s.emit("game:moves", g.movesJSON())
+
+	if g.You != nil && g.Opponent != nil {
+		s.emit("game:players", g.playersJSON(g.playerOfColor(White), g.playerOfColor(Black)))
+	}
+
+	s.emit("game:end-state", g.endState)
+	if g.ended {
+		s.emit("game:result", g.resultJSON())
+	}
+}
+
+// movesJSON returns the moves played so far in the order they were played
+func (g *GameController) movesJSON() string {
+	data, _ := json.Marshal(append([]Move{}, g.moves...))
+	return string(data)
+}
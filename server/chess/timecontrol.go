@@ -0,0 +1,321 @@
+package chess
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enum how a time control's increment is applied after each move
+const (
+	Fischer int = iota
+	Bronstein
+	SimpleDelay
+)
+
+var delayNames = []string{"fischer", "bronstein", "simple"}
+
+// Enum special rules a time control can be played with
+const (
+	Standard int = iota
+	Hourglass
+	Armageddon
+	Correspondence
+)
+
+var modeNames = []string{"standard", "hourglass", "armageddon", "correspondence"}
+
+// Categories games are rated in, decided by how long a time control is expected to last
+const (
+	CategoryBullet         = "bullet"
+	CategoryBlitz          = "blitz"
+	CategoryRapid          = "rapid"
+	CategoryClassical      = "classical"
+	CategoryCorrespondence = "correspondence"
+)
+
+// TimeControlStage is one period of a time control, e.g. 40/5400+30 in 40/5400+30:1800+30
+type TimeControlStage struct {
+	Moves     int           // moves to play in this stage, 0 means the rest of the game
+	Time      time.Duration // time added to the clock when the stage starts
+	Increment time.Duration // increment or delay applied to every move in this stage
+}
+
+// TimeControl describes how much time each player gets and how their clock is replenished
+type TimeControl struct {
+	Stages []TimeControlStage
+	Delay  int
+	Mode   int
+
+	// BlackStages replaces Stages for black in armageddon, where black has less time
+	BlackStages []TimeControlStage
+}
+
+// MaxDaysPerMove is the most days a correspondence game can give each move
+const MaxDaysPerMove = 30
+
+// CorrespondenceTimeControl returns a time control giving each player days to make every move,
+// days must be between 1 and MaxDaysPerMove
+func CorrespondenceTimeControl(days int) (*TimeControl, error) {
+	if days <= 0 || days > MaxDaysPerMove {
+		return nil, fmt.Errorf("correspondence games need 1 to %d days per move", MaxDaysPerMove)
+	}
+
+	return &TimeControl{Stages: []TimeControlStage{{Moves: 1, Time: time.Duration(days) * 24 * time.Hour}}, Mode: Correspondence}, nil
+}
+
+// DefaultTimeControl returns the 10 minute time control games used before time controls were configurable
+func DefaultTimeControl() *TimeControl {
+	return &TimeControl{Stages: []TimeControlStage{{Time: 10 * time.Minute}}, Delay: Fischer}
+}
+
+// ParseTimeControl parses a PGN style time control such as "300+5" or "40/5400+30:1800+30"
+// where times are in seconds, along with the name of the delay method ("fischer", "bronstein" or "simple")
+// a sandclock time control such as "*300" is played as hourglass
+func ParseTimeControl(pgn string, delay string) (*TimeControl, error) {
+	tc := &TimeControl{}
+
+	switch delay {
+	case "", "fischer", "increment":
+		tc.Delay = Fischer
+	case "bronstein":
+		tc.Delay = Bronstein
+	case "simple", "delay":
+		tc.Delay = SimpleDelay
+	default:
+		return nil, fmt.Errorf("unknown delay method %q", delay)
+	}
+
+	if strings.TrimSpace(pgn) == "" {
+		return nil, errors.New("time control is empty")
+	}
+
+	if strings.HasPrefix(pgn, "*") {
+		sandclock, err := parseSeconds(pgn[1:])
+		if err != nil || sandclock <= 0 {
+			return nil, fmt.Errorf("invalid sandclock time in %q", pgn)
+		}
+
+		tc.Mode = Hourglass
+		tc.Stages = []TimeControlStage{{Time: sandclock}}
+		return tc, nil
+	}
+
+	for _, field := range strings.Split(pgn, ":") {
+		var stage TimeControlStage
+		var err error
+
+		if i := strings.Index(field, "/"); i >= 0 {
+			if stage.Moves, err = strconv.Atoi(field[:i]); err != nil || stage.Moves <= 0 {
+				return nil, fmt.Errorf("invalid move count in %q", field)
+			}
+			field = field[i+1:]
+		}
+
+		seconds, increment := field, "0"
+		if i := strings.Index(field, "+"); i >= 0 {
+			seconds, increment = field[:i], field[i+1:]
+		}
+
+		if stage.Time, err = parseSeconds(seconds); err != nil || stage.Time <= 0 {
+			return nil, fmt.Errorf("invalid time in %q", field)
+		}
+		if stage.Increment, err = parseSeconds(increment); err != nil || stage.Increment < 0 {
+			return nil, fmt.Errorf("invalid increment in %q", field)
+		}
+
+		tc.Stages = append(tc.Stages, stage)
+	}
+
+	return tc, nil
+}
+
+func parseSeconds(s string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	} else if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, fmt.Errorf("%q is not a number of seconds", s)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// SetMode sets the special rules the time control is played with ("standard", "hourglass", "armageddon"
+// or "correspondence"), black's time control in armageddon is given in the same format as ParseTimeControl
+func (tc *TimeControl) SetMode(mode string, black string) error {
+	switch mode {
+	case "", "standard":
+		// sandclock time controls are already hourglass
+		if tc.Mode != Hourglass {
+			tc.Mode = Standard
+		}
+	case "hourglass":
+		if len(tc.Stages) != 1 || tc.Stages[0].Increment > 0 {
+			return errors.New("hourglass is played with a single period and no increment")
+		}
+		tc.Mode = Hourglass
+	case "armageddon":
+		blackTC, err := ParseTimeControl(black, tc.DelayName())
+		if err != nil {
+			return fmt.Errorf("black's time control: %w", err)
+		} else if blackTC.Mode != Standard {
+			return errors.New("black's time control can't be a sandclock")
+		}
+
+		tc.Mode = Armageddon
+		tc.BlackStages = blackTC.Stages
+	case "correspondence":
+		if len(tc.Stages) != 1 || tc.Stages[0].Moves > 1 || tc.Stages[0].Increment > 0 {
+			return errors.New("correspondence is played with a single period per move")
+		}
+		tc.Mode = Correspondence
+		tc.Stages[0].Moves = 1
+	default:
+		return fmt.Errorf("unknown time control mode %q", mode)
+	}
+
+	return nil
+}
+
+// ModeName returns the name of the special rules the time control is played with
+func (tc *TimeControl) ModeName() string {
+	return modeNames[tc.Mode]
+}
+
+// String returns the time control in PGN TimeControl tag format, for armageddon this is white's time control
+func (tc *TimeControl) String() string {
+	if tc.Mode == Hourglass {
+		return "*" + formatSeconds(tc.Stages[0].Time)
+	}
+
+	return formatStages(tc.Stages)
+}
+
+// BlackString returns black's time control in armageddon in PGN TimeControl tag format
+func (tc *TimeControl) BlackString() string {
+	return formatStages(tc.BlackStages)
+}
+
+func formatStages(stages []TimeControlStage) string {
+	fields := make([]string, len(stages))
+	for i, stage := range stages {
+		field := formatSeconds(stage.Time)
+		if stage.Moves > 0 {
+			field = fmt.Sprintf("%d/%s", stage.Moves, field)
+		}
+		if stage.Increment > 0 {
+			field += "+" + formatSeconds(stage.Increment)
+		}
+
+		fields[i] = field
+	}
+
+	return strings.Join(fields, ":")
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// Category returns the rating category of the time control, based on the time a 40 move game
+// is expected to take for one player
+func (tc *TimeControl) Category() string {
+	if tc.Mode == Correspondence {
+		return CategoryCorrespondence
+	}
+
+	first := tc.Stages[0]
+	expected := first.Time + 40*first.Increment
+
+	switch {
+	case expected < 3*time.Minute:
+		return CategoryBullet
+	case expected < 8*time.Minute:
+		return CategoryBlitz
+	case expected < 25*time.Minute:
+		return CategoryRapid
+	default:
+		return CategoryClassical
+	}
+}
+
+// DelayName returns the name of the time control's delay method
+func (tc *TimeControl) DelayName() string {
+	return delayNames[tc.Delay]
+}
+
+// stagesFor returns the stages p plays, black has their own stages in armageddon
+func (tc *TimeControl) stagesFor(p *Player) []TimeControlStage {
+	if tc.Mode == Armageddon && p.color == Black {
+		return tc.BlackStages
+	}
+
+	return tc.Stages
+}
+
+// stage returns the stage p is in, the last stage repeats when it has a move count
+func (tc *TimeControl) stage(p *Player) TimeControlStage {
+	stages := tc.stagesFor(p)
+	if p.stage >= len(stages) {
+		return stages[len(stages)-1]
+	}
+
+	return stages[p.stage]
+}
+
+// start gives p a clock with the time for the first stage of the time control
+func (tc *TimeControl) start(p *Player) {
+	p.stage = 0
+	p.stageMoves = 0
+	p.clock = NewClock(tc.stage(p).Time)
+}
+
+// startTurn starts p's clock for their turn
+func (tc *TimeControl) startTurn(p *Player) {
+	delay := time.Duration(0)
+	if tc.Delay == SimpleDelay {
+		delay = tc.stage(p).Increment
+	}
+
+	p.clock.Start(delay)
+}
+
+// endTurn stops p's clock after they have made a move and then applies the
+// increment or delay and any time gained from moving into the next stage
+// @returns how long the move took
+func (tc *TimeControl) endTurn(p *Player) time.Duration {
+	stage := tc.stage(p)
+	spent := p.clock.Stop()
+
+	switch tc.Delay {
+	case Fischer:
+		p.clock.Add(stage.Increment)
+	case Bronstein:
+		if p.clock.Remaining() > 0 {
+			p.clock.Add(minDuration(spent, stage.Increment))
+		}
+	}
+
+	// correspondence players get the full time again for every move
+	if tc.Mode == Correspondence {
+		p.clock.Set(stage.Time)
+		return spent
+	}
+
+	p.stageMoves++
+	if stage.Moves > 0 && p.stageMoves == stage.Moves {
+		p.stage++
+		p.stageMoves = 0
+		p.clock.Add(tc.stage(p).Time)
+	}
+
+	return spent
+}
+
+func durationToMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// CODE_LENGTH is the number of letters in a letter game code
+const CODE_LENGTH = 6
+
+// maxCodeAttempts is how many codes are tried before giving up on finding one that isn't in use
+const maxCodeAttempts = 100
+
+var errNoFreeCode = errors.New("couldn't find a free game code")
+
+// errCodeInUse is returned if a game is given a code another game is already registered under, codes
+// from the generator are unique so it means a code was handed out twice
+var errCodeInUse = errors.New("game code is already in use")
+
+const codeLetters = "abcdefghijklmnopqrstuvwxyz"
+
+// words word codes are made from, adjective-noun-number e.g. brave-otter-42
+var (
+	codeAdjectives = []string{
+		"brave", "calm", "clever", "cosy", "crafty", "daring", "eager", "fancy",
+		"fierce", "gentle", "giddy", "glad", "grand", "happy", "humble", "jolly",
+		"keen", "kind", "lively", "lucky", "merry", "mighty", "nimble", "noble",
+		"plucky", "polite", "proud", "quick", "quiet", "rapid", "sharp", "shy",
+		"silly", "sleepy", "sly", "smart", "snappy", "speedy", "spry", "steady",
+		"stout", "sunny", "swift", "tidy", "tiny", "wise", "witty", "zesty",
+	}
+	codeNouns = []string{
+		"badger", "bear", "beaver", "bison", "camel", "crane", "crow", "deer",
+		"dingo", "eagle", "falcon", "ferret", "fox", "gecko", "goat", "goose",
+		"hare", "hawk", "heron", "horse", "ibex", "koala", "lemur", "lion",
+		"llama", "lynx", "magpie", "marten", "mole", "moose", "newt", "otter",
+		"owl", "panda", "parrot", "pigeon", "puffin", "rabbit", "raven", "robin",
+		"seal", "shrew", "sloth", "stoat", "swan", "tiger", "toad", "walrus",
+	}
+)
+
+// CodeGenerator hands out game codes that aren't used by another game, it is safe for concurrent use
+type CodeGenerator struct {
+	mu    sync.Mutex
+	inUse map[string]bool
+	words bool
+}
+
+// NewCodeGenerator creates a generator of 6 letter codes or, if words is set, word codes like brave-otter-42
+func NewCodeGenerator(words bool) *CodeGenerator {
+	return &CodeGenerator{inUse: make(map[string]bool), words: words}
+}
+
+// Generate returns a random code that isn't in use and reserves it until it is released
+func (g *CodeGenerator) Generate() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i := 0; i < maxCodeAttempts; i++ {
+		var code string
+		var err error
+		if g.words {
+			code, err = wordCode()
+		} else {
+			code, err = letterCode()
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if !g.inUse[code] {
+			g.inUse[code] = true
+			return code, nil
+		}
+	}
+
+	return "", errNoFreeCode
+}
+
+// Reserve marks code as in use, e.g. for a game restored at startup
+// @returns false if the code was already in use
+func (g *CodeGenerator) Reserve(code string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.inUse[code] {
+		return false
+	}
+
+	g.inUse[code] = true
+	return true
+}
+
+// Release lets code be handed out again
+func (g *CodeGenerator) Release(code string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.inUse, code)
+}
+
+func letterCode() (string, error) {
+	var b strings.Builder
+	for i := 0; i < CODE_LENGTH; i++ {
+		n, err := randomInt(len(codeLetters))
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteByte(codeLetters[n])
+	}
+
+	return b.String(), nil
+}
+
+func wordCode() (string, error) {
+	adjective, err := randomInt(len(codeAdjectives))
+	if err != nil {
+		return "", err
+	}
+	noun, err := randomInt(len(codeNouns))
+	if err != nil {
+		return "", err
+	}
+	number, err := randomInt(90)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%s-%d", codeAdjectives[adjective], codeNouns[noun], number+10), nil
+}
+
+// randomInt returns a uniformly random number in [0, n) from crypto/rand
+func randomInt(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(i.Int64()), nil
+}
@@ -0,0 +1,273 @@
+// Package config loads the server's settings from a YAML file, environment variables and flags,
+// later sources override earlier ones
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// styles of game code
+const (
+	CodesLetters = "letters"
+	CodesWords   = "words"
+)
+
+// Config is everything about the server that can be changed without recompiling it
+type Config struct {
+	// Production serves the session cookie to the client's origin as a secure cross site cookie
+	Production     bool     `yaml:"production"`
+	Listen         string   `yaml:"listen"`
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	LogLevel       string   `yaml:"logLevel"`
+	LogFormat      string   `yaml:"logFormat"`
+
+	// DefaultTimeControl and DefaultDelay are used for games created without a time control
+	DefaultTimeControl string `yaml:"defaultTimeControl"`
+	DefaultDelay       string `yaml:"defaultDelay"`
+	// GracePeriod is how long a disconnected player has to rejoin before their opponent can claim the win
+	GracePeriod time.Duration `yaml:"gracePeriod"`
+	// ShutdownTimeout is how long the server has to save its games and close its sockets once it is told to stop
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// GameCodes is letters for 6 letter codes or words for codes like brave-otter-42, clients older than
+	// word codes only accept letter codes
+	GameCodes string `yaml:"gameCodes"`
+
+	Database string `yaml:"database"`
+	// SessionSecret signs the tokens players rejoin games with, one is generated and saved in the
+	// database if it is empty
+	SessionSecret string `yaml:"sessionSecret"`
+
+	// PrintConfig prints the loaded config instead of starting the server
+	PrintConfig bool `yaml:"-"`
+}
+
+// Default returns the settings the server is deployed with
+func Default() *Config {
+	return &Config{
+		Production:         true,
+		Listen:             ":8000",
+		AllowedOrigins:     []string{"https://scuffedchess.netlify.app", "https://scuffedchess.online", "https://www.scuffedchess.online"},
+		LogLevel:           "info",
+		LogFormat:          logging.FormatJSON,
+		DefaultTimeControl: "600",
+		DefaultDelay:       "fischer",
+		GracePeriod:        time.Minute,
+		ShutdownTimeout:    10 * time.Second,
+		GameCodes:          CodesLetters,
+		Database:           "scuffed-chess.db",
+	}
+}
+
+// Load builds the config from the defaults, the YAML file given with -config or CONFIG_FILE,
+// environment variables and then the flags in args, and validates it
+func Load(args []string) (*Config, error) {
+	// the flags are parsed once to find the config file, then again on top of the file and environment
+	path := os.Getenv("CONFIG_FILE")
+	flags := Default().flagSet()
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			path = f.Value.String()
+		}
+	})
+
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.flagSet().Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// flagSet returns the command line flags, each one writes to its setting in cfg
+func (cfg *Config) flagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet("scuffed-chess", flag.ContinueOnError)
+
+	flags.String("config", "", "YAML file to load settings from")
+	flags.BoolVar(&cfg.Production, "production", cfg.Production, "serve the session cookie cross site")
+	flags.StringVar(&cfg.Listen, "listen", cfg.Listen, "address to listen on e.g. :8000")
+	flags.Func("origins", "comma separated origins allowed to connect", func(value string) error {
+		cfg.AllowedOrigins = splitList(value)
+		return nil
+	})
+	flags.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "debug, info, warn, error or off")
+	flags.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "json or logfmt")
+	flags.StringVar(&cfg.DefaultTimeControl, "default-time-control", cfg.DefaultTimeControl, "PGN time control of games created without one")
+	flags.StringVar(&cfg.DefaultDelay, "default-delay", cfg.DefaultDelay, "delay method of the default time control")
+	flags.DurationVar(&cfg.GracePeriod, "grace-period", cfg.GracePeriod, "how long disconnected players have to rejoin")
+	flags.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "how long the server has to shut down")
+	flags.StringVar(&cfg.GameCodes, "game-codes", cfg.GameCodes, "letters or words")
+	flags.StringVar(&cfg.Database, "database", cfg.Database, "path of the database file")
+	flags.StringVar(&cfg.SessionSecret, "session-secret", cfg.SessionSecret, "secret session tokens are signed with")
+	flags.BoolVar(&cfg.PrintConfig, "print-config", false, "print the config and exit")
+
+	return flags
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// loadEnv overrides settings with environment variables, PORT is supported since it is how
+// the hosting platform tells the server where to listen
+func (cfg *Config) loadEnv() error {
+	if value, ok := os.LookupEnv("PRODUCTION"); ok {
+		production, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid PRODUCTION: %w", err)
+		}
+		cfg.Production = production
+	}
+
+	if port, ok := os.LookupEnv("PORT"); ok {
+		cfg.Listen = ":" + port
+	}
+	if value, ok := os.LookupEnv("GRACE_PERIOD"); ok {
+		grace, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid GRACE_PERIOD: %w", err)
+		}
+		cfg.GracePeriod = grace
+	}
+	if value, ok := os.LookupEnv("SHUTDOWN_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid SHUTDOWN_TIMEOUT: %w", err)
+		}
+		cfg.ShutdownTimeout = timeout
+	}
+	if value, ok := os.LookupEnv("ALLOWED_ORIGINS"); ok {
+		cfg.AllowedOrigins = splitList(value)
+	}
+
+	settings := map[string]*string{
+		"LISTEN_ADDR":          &cfg.Listen,
+		"LOG_LEVEL":            &cfg.LogLevel,
+		"LOG_FORMAT":           &cfg.LogFormat,
+		"DEFAULT_TIME_CONTROL": &cfg.DefaultTimeControl,
+		"DEFAULT_DELAY":        &cfg.DefaultDelay,
+		"GAME_CODES":           &cfg.GameCodes,
+		"DATABASE_PATH":        &cfg.Database,
+		"SESSION_SECRET":       &cfg.SessionSecret,
+	}
+	for name, setting := range settings {
+		if value, ok := os.LookupEnv(name); ok {
+			*setting = value
+		}
+	}
+
+	return nil
+}
+
+// Validate returns what is wrong with the config, nil if it can be used
+func (cfg *Config) Validate() error {
+	if _, _, err := net.SplitHostPort(cfg.Listen); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", cfg.Listen, err)
+	}
+
+	if len(cfg.AllowedOrigins) == 0 {
+		return errors.New("no allowed origins")
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("invalid allowed origin %q", origin)
+		}
+	}
+
+	if _, err := logging.ParseLevel(cfg.LogLevel); err != nil {
+		return fmt.Errorf("invalid log level %q, it must be debug, info, warn, error or off", cfg.LogLevel)
+	}
+	if cfg.LogFormat != logging.FormatJSON && cfg.LogFormat != logging.FormatLogfmt {
+		return fmt.Errorf("invalid log format %q, it must be json or logfmt", cfg.LogFormat)
+	}
+
+	if _, err := cfg.TimeControl(); err != nil {
+		return fmt.Errorf("invalid default time control: %w", err)
+	}
+
+	if cfg.GracePeriod <= 0 {
+		return errors.New("grace period must be positive")
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		return errors.New("shutdown timeout must be positive")
+	}
+
+	if cfg.GameCodes != CodesLetters && cfg.GameCodes != CodesWords {
+		return fmt.Errorf("invalid game codes %q, they must be letters or words", cfg.GameCodes)
+	}
+
+	if cfg.Database == "" {
+		return errors.New("no database path")
+	}
+
+	return nil
+}
+
+// TimeControl returns a new copy of the default time control
+func (cfg *Config) TimeControl() (*c.TimeControl, error) {
+	return c.ParseTimeControl(cfg.DefaultTimeControl, cfg.DefaultDelay)
+}
+
+// YAML returns the config as it would be written in a config file, the session secret is hidden
+func (cfg *Config) YAML() string {
+	printed := *cfg
+	if printed.SessionSecret != "" {
+		printed.SessionSecret = "<hidden>"
+	}
+
+	data, _ := yaml.Marshal(&printed)
+	return string(data)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	socketio "github.com/googollee/go-socket.io"
+)
+
+// socketConnection adapts a socket.io connection to the connection games send their events on
+type socketConnection struct {
+	s socketio.Conn
+}
+
+func newSocketConnection(s socketio.Conn) c.Connection {
+	return &socketConnection{s}
+}
+
+func (conn *socketConnection) ID() string {
+	return conn.s.ID()
+}
+
+func (conn *socketConnection) Emit(event string, args ...interface{}) {
+	conn.s.Emit(event, args...)
+}
+
+func (conn *socketConnection) Close() error {
+	return conn.s.Close()
+}
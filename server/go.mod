@@ -3,6 +3,9 @@ module github.com/freddie-nelson/scuffed-chess/server
 go 1.16
 
 require (
-	github.com/googollee/go-socket.io v1.6.1 // indirect
-	github.com/rs/cors v1.8.0 // indirect
+	github.com/googollee/go-socket.io v1.6.1
+	github.com/rs/cors v1.8.0
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/crypto v0.0.0-20220214200702-86341886e292
+	gopkg.in/yaml.v3 v3.0.1
 )
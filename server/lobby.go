@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+)
+
+var errUnknownVariant = errors.New("unknown variant")
+var errSeekNotFound = errors.New("seek not found")
+var errOwnSeek = errors.New("can't accept your own seek")
+
+// seekOptions are the settings a client can send with game:seek
+type seekOptions struct {
+	gameOptions
+
+	Variant string `json:"variant"` // "standard"
+}
+
+// Seek is an open challenge posted to the lobby, anyone can accept it to start a game
+type Seek struct {
+	ID        string
+	Username  string
+	Variant   string
+	Colour    string
+	Rated     bool
+	CreatedAt time.Time
+
+	tc *c.TimeControl
+	// account is the seeker's account, empty for guests
+	account string
+	conn    c.Connection
+}
+
+type seekJSON struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	TimeControl string `json:"timeControl"`
+	Delay       string `json:"delay"`
+	Mode        string `json:"mode"`
+	Variant     string `json:"variant"`
+	Colour      string `json:"colour"`
+	Rated       bool   `json:"rated"`
+	CreatedAt   int64  `json:"createdAt"`
+}
+
+// Lobby holds the open seeks and the sockets subscribed to them, it is safe for concurrent use
+type Lobby struct {
+	mu sync.Mutex
+
+	seeks  map[string]*Seek
+	nextID int
+	// subscribers maps socket ids to the sockets that are sent lobby:list whenever the seeks change
+	subscribers map[string]c.Connection
+}
+
+// NewLobby creates an empty lobby
+func NewLobby() *Lobby {
+	return &Lobby{
+		seeks:       make(map[string]*Seek),
+		subscribers: make(map[string]c.Connection),
+	}
+}
+
+// Post adds a seek for the player connected on conn, account is empty for guests
+// @returns the seek's id
+func (l *Lobby) Post(conn c.Connection, username string, account string, options seekOptions) (string, error) {
+	tc, err := newTimeControl(options.gameOptions)
+	if err != nil {
+		return "", err
+	}
+
+	variant := options.Variant
+	if variant == "" {
+		variant = c.VariantStandard
+	} else if variant != c.VariantStandard {
+		return "", errUnknownVariant
+	}
+
+	colour, err := parseColour(options.Colour)
+	if err != nil {
+		return "", err
+	}
+
+	l.mu.Lock()
+	l.nextID++
+	id := strconv.Itoa(l.nextID)
+	l.seeks[id] = &Seek{id, username, variant, colour, options.Rated, time.Now(), tc, account, conn}
+	l.mu.Unlock()
+
+	l.broadcast()
+	return id, nil
+}
+
+// Cancel removes the seek with id if it was posted by the socket with socketID
+// @returns wether the seek was removed
+func (l *Lobby) Cancel(socketID string, id string) bool {
+	l.mu.Lock()
+	seek, exists := l.seeks[id]
+	if !exists || seek.conn.ID() != socketID {
+		l.mu.Unlock()
+		return false
+	}
+	delete(l.seeks, id)
+	l.mu.Unlock()
+
+	l.broadcast()
+	return true
+}
+
+// Accept removes the seek with id so that the socket with socketID can start a game from it
+func (l *Lobby) Accept(socketID string, id string) (*Seek, error) {
+	l.mu.Lock()
+	seek, exists := l.seeks[id]
+	if !exists {
+		l.mu.Unlock()
+		return nil, errSeekNotFound
+	} else if seek.conn.ID() == socketID {
+		l.mu.Unlock()
+		return nil, errOwnSeek
+	}
+	delete(l.seeks, id)
+	l.mu.Unlock()
+
+	l.broadcast()
+	return seek, nil
+}
+
+// Restore puts back a seek that was accepted but whose game couldn't be started
+func (l *Lobby) Restore(seek *Seek) {
+	l.mu.Lock()
+	l.seeks[seek.ID] = seek
+	l.mu.Unlock()
+
+	l.broadcast()
+}
+
+// Subscribe sends conn the current seeks and keeps it updated as they change
+func (l *Lobby) Subscribe(conn c.Connection) {
+	l.mu.Lock()
+	l.subscribers[conn.ID()] = conn
+	list := l.listJSON()
+	l.mu.Unlock()
+
+	conn.Emit("lobby:list", list)
+}
+
+// Unsubscribe stops sending lobby:list to the socket with id
+func (l *Lobby) Unsubscribe(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.subscribers, id)
+}
+
+// Disconnect removes the socket's subscription and the seeks it posted
+func (l *Lobby) Disconnect(id string) {
+	l.mu.Lock()
+	delete(l.subscribers, id)
+
+	removed := false
+	for seekID, seek := range l.seeks {
+		if seek.conn.ID() == id {
+			delete(l.seeks, seekID)
+			removed = true
+		}
+	}
+	l.mu.Unlock()
+
+	if removed {
+		l.broadcast()
+	}
+}
+
+// broadcast sends the current seeks to every subscriber. Emitting can block on a slow socket so it is
+// done without holding l.mu, which must not be held by the caller
+func (l *Lobby) broadcast() {
+	l.mu.Lock()
+	list := l.listJSON()
+	subscribers := make([]c.Connection, 0, len(l.subscribers))
+	for _, conn := range l.subscribers {
+		subscribers = append(subscribers, conn)
+	}
+	l.mu.Unlock()
+
+	for _, conn := range subscribers {
+		conn.Emit("lobby:list", list)
+	}
+}
+
+// listJSON returns the lobby:list data, the oldest seeks come first
+func (l *Lobby) listJSON() string {
+	seeks := make([]seekJSON, 0, len(l.seeks))
+	for _, seek := range l.seeks {
+		seeks = append(seeks, seekJSON{
+			ID:          seek.ID,
+			Username:    seek.Username,
+			TimeControl: seek.tc.String(),
+			Delay:       seek.tc.DelayName(),
+			Mode:        seek.tc.ModeName(),
+			Variant:     seek.Variant,
+			Colour:      seek.Colour,
+			Rated:       seek.Rated,
+			CreatedAt:   unixMillis(seek.CreatedAt),
+		})
+	}
+
+	sort.Slice(seeks, func(i, j int) bool {
+		return seeks[i].CreatedAt < seeks[j].CreatedAt
+	})
+
+	data, _ := json.Marshal(seeks)
+	return string(data)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/config"
+)
+
+// fakeConnection records the events sent to it
+type fakeConnection struct {
+	id string
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (conn *fakeConnection) ID() string {
+	return conn.id
+}
+
+func (conn *fakeConnection) Emit(event string, args ...interface{}) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	conn.events = append(conn.events, event)
+}
+
+func (conn *fakeConnection) Close() error {
+	return nil
+}
+
+// received returns how many times event was sent to the connection
+func (conn *fakeConnection) received(event string) int {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	n := 0
+	for _, e := range conn.events {
+		if e == event {
+			n++
+		}
+	}
+
+	return n
+}
+
+// TestLobbySeeks posts, accepts and removes seeks, checking subscribers are sent the seeks each time
+func TestLobbySeeks(t *testing.T) {
+	cfg = config.Default()
+
+	l := NewLobby()
+	seeker, subscriber := &fakeConnection{id: "seeker"}, &fakeConnection{id: "subscriber"}
+
+	l.Subscribe(subscriber)
+	if lists := subscriber.received("lobby:list"); lists != 1 {
+		t.Fatalf("subscriber was sent lobby:list %d times on subscribing, want 1", lists)
+	}
+
+	id, err := l.Post(seeker, "seeker", "", seekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Accept(seeker.ID(), id); err != errOwnSeek {
+		t.Fatalf("accepting own seek returned %v, want %v", err, errOwnSeek)
+	}
+
+	seek, err := l.Accept(subscriber.ID(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seek.conn != seeker {
+		t.Fatal("accepted seek isn't on the seeker's connection")
+	}
+
+	l.Restore(seek)
+	l.Disconnect(seeker.ID())
+	if _, err := l.Accept(subscriber.ID(), id); err != errSeekNotFound {
+		t.Fatalf("accepting a disconnected seeker's seek returned %v, want %v", err, errSeekNotFound)
+	}
+
+	// posted, accepted, restored and removed on disconnect
+	if lists := subscriber.received("lobby:list"); lists != 5 {
+		t.Fatalf("subscriber was sent lobby:list %d times, want 5", lists)
+	}
+	if lists := seeker.received("lobby:list"); lists != 0 {
+		t.Fatalf("seeker was sent lobby:list %d times without subscribing", lists)
+	}
+}
+
+// TestMatchQueuePairs checks players waiting for the same time control with close ratings are matched
+func TestMatchQueuePairs(t *testing.T) {
+	ratings := map[string]float64{"a": 1500, "b": 1550, "c": 2500}
+	var matches [][2]*queueEntry
+	q := NewMatchQueue(func(account string, tc *c.TimeControl) float64 {
+		return ratings[account]
+	}, func(a, b *queueEntry) {
+		matches = append(matches, [2]*queueEntry{a, b})
+	})
+
+	tc := c.DefaultTimeControl()
+	q.Join(&fakeConnection{id: "a"}, "a", "a", tc)
+	q.Join(&fakeConnection{id: "c"}, "c", "c", tc)
+	if len(matches) != 0 {
+		t.Fatalf("%d matches were made between players outside each other's window", len(matches))
+	}
+
+	q.Join(&fakeConnection{id: "b"}, "b", "b", tc)
+	if len(matches) != 1 || matches[0][0].conn.ID() != "a" || matches[0][1].conn.ID() != "b" {
+		t.Fatalf("matches are %v, want a against b", matches)
+	}
+
+	if !q.Leave("c") || q.Leave("a") {
+		t.Fatal("only c should have been left waiting")
+	}
+}
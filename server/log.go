@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/logging"
+	socketio "github.com/googollee/go-socket.io"
+)
+
+// logger writes the server's log lines, it is replaced once the config is loaded
+var logger = logging.New(os.Stderr, logging.Info, logging.FormatJSON)
+
+// eventLogger returns a logger for the handling of an event the socket sent
+func eventLogger(s socketio.Conn, event string) *logging.Logger {
+	return logger.With("socket", s.ID(), "event", event)
+}
+
+// gameLogger returns a logger for lines about a game
+func gameLogger(g *c.GameController) *logging.Logger {
+	return logger.With("game", g.Code())
+}
+
+// fatal logs msg as an error and exits
+func fatal(msg string, kv ...interface{}) {
+	logger.Error(msg, kv...)
+	os.Exit(1)
+}
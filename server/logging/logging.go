@@ -0,0 +1,194 @@
+// Package logging writes levelled, structured log lines as JSON or logfmt. Loggers carry fields such as
+// the game code and socket id so every line about a game can be found together
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is how important a log line is, lines below a logger's level are dropped
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+	// Off drops every line
+	Off
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "off"}
+
+func (l Level) String() string {
+	if l < Debug || l > Off {
+		return "unknown"
+	}
+
+	return levelNames[l]
+}
+
+// ParseLevel returns the level called name
+func ParseLevel(name string) (Level, error) {
+	for l, n := range levelNames {
+		if n == name {
+			return Level(l), nil
+		}
+	}
+
+	return Off, fmt.Errorf("unknown log level %q", name)
+}
+
+// formats lines can be written in
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// field is a key and value attached to a log line
+type field struct {
+	key   string
+	value interface{}
+}
+
+// output is shared between a logger and the loggers derived from it so their lines don't interleave
+type output struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Logger writes log lines with its fields to its output, it is safe for concurrent use
+type Logger struct {
+	out    *output
+	level  Level
+	format string
+	fields []field
+}
+
+// New creates a logger writing lines at level or above to w in format, FormatJSON or FormatLogfmt
+func New(w io.Writer, level Level, format string) *Logger {
+	return &Logger{out: &output{w: w}, level: level, format: format}
+}
+
+// With returns a logger that adds the alternating keys and values in kv to each line
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]field, 0, len(l.fields)+len(kv)/2)
+	fields = append(fields, l.fields...)
+
+	return &Logger{out: l.out, level: l.level, format: l.format, fields: appendFields(fields, kv)}
+}
+
+// Enabled returns true if lines at level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level && l.level != Off
+}
+
+// Debug logs msg with the alternating keys and values in kv, as do Info, Warn and Error
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(Debug, msg, kv)
+}
+
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(Info, msg, kv)
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(Warn, msg, kv)
+}
+
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(Error, msg, kv)
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := []field{{"time", time.Now().UTC().Format(time.RFC3339Nano)}, {"level", level.String()}, {"msg", msg}}
+	fields = append(fields, l.fields...)
+	fields = appendFields(fields, kv)
+
+	var line string
+	if l.format == FormatLogfmt {
+		line = logfmt(fields)
+	} else {
+		line = jsonLine(fields)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+
+	io.WriteString(l.out.w, line+"\n")
+}
+
+// appendFields adds the alternating keys and values in kv to fields, a key without a value is logged
+// with the value "MISSING"
+func appendFields(fields []field, kv []interface{}) []field {
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+
+		var value interface{} = "MISSING"
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+
+		fields = append(fields, field{key, value})
+	}
+
+	return fields
+}
+
+func jsonLine(fields []field) string {
+	var b strings.Builder
+	b.WriteString("{")
+
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(",")
+		}
+
+		key, _ := json.Marshal(f.key)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(f.value))
+		}
+
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(value)
+	}
+
+	b.WriteString("}")
+	return b.String()
+}
+
+func logfmt(fields []field) string {
+	var b strings.Builder
+
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+
+		b.WriteString(f.key)
+		b.WriteString("=")
+
+		value := fmt.Sprint(f.value)
+		if value == "" || strings.ContainsAny(value, " =\"\\\n\t") {
+			value = strconv.Quote(value)
+		}
+		b.WriteString(value)
+	}
+
+	return b.String()
+}
@@ -1,134 +1,698 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"math/rand"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/config"
+	"github.com/freddie-nelson/scuffed-chess/server/logging"
+	"github.com/freddie-nelson/scuffed-chess/server/ratings"
+	"github.com/freddie-nelson/scuffed-chess/server/storage"
 	socketio "github.com/googollee/go-socket.io"
 	"github.com/rs/cors"
 )
 
-const PRODUCTION = true
+// SESSION_TTL is how long the tokens players use to rejoin games are valid for
+const SESSION_TTL = 30 * 24 * time.Hour
 
-var games map[string]*c.GameController
-var players map[string]string
+// INVITE_TTL is how long an invite to a game's open seat is valid for
+const INVITE_TTL = 24 * time.Hour
+
+// cfg is the server's config, loaded from a config file, the environment and flags at startup
+var cfg *config.Config
+
+var registry *GameRegistry
+
+var lobby *Lobby
+
+var queue *MatchQueue
+
+// codes hands out the codes of new games
+var codes *CodeGenerator
+
+// chatLimiter lets each socket send 5 chat messages in a burst and then one every 2 seconds
+var chatLimiter = NewRateLimiter(5, 2*time.Second)
+
+// joinLimiter lets each socket get a room password wrong 5 times in a burst and then once every 10 seconds,
+// gameJoinLimiter does the same for each game across every socket so its password can't be brute forced
+var joinLimiter = NewRateLimiter(5, 10*time.Second)
+var gameJoinLimiter = NewRateLimiter(20, 10*time.Second)
+
+// ratingsMu stops games that end at the same time overwriting each other's rating updates
+var ratingsMu sync.Mutex
+
+// persistMu orders saving and deleting games so a game that is being removed isn't saved again
+var persistMu sync.Mutex
+
+var store storage.Store
+
+var sessions *SessionSigner
+
+// invites signs invites to games' open seats, they have their own secret so a session token can't be used
+// as an invite
+var invites *SessionSigner
+
+// gameOptions are the optional settings a client can send with game:create
+type gameOptions struct {
+	TimeControl string `json:"timeControl"` // PGN time control in seconds e.g. "300+5" or "40/5400+30:1800+30"
+	Delay       string `json:"delay"`       // how the increment is applied: "fischer", "bronstein" or "simple"
+
+	TimeMode         string `json:"timeMode"`         // "standard", "hourglass", "armageddon" or "correspondence"
+	BlackTimeControl string `json:"blackTimeControl"` // black's time control in armageddon
+	DaysPerMove      int    `json:"daysPerMove"`      // days each player has per move in correspondence, 1 to 30
+
+	Rated  bool   `json:"rated"`  // wether the game changes the players' ratings
+	Colour string `json:"colour"` // the colour the creator plays: "white" (the default), "black" or "random"
+
+	Password string `json:"password"` // the password needed to join the game, none for an open game
+	Invitee  string `json:"invitee"`  // the registered player the open seat is reserved for
+}
+
+// joinOptions are what a client can send with game:join to take a private game's open seat
+type joinOptions struct {
+	Password string `json:"password"`
+	Invite   string `json:"invite"` // an invite from game:invite, it can be used instead of the password
+}
+
+var errGameNotFound = errors.New("game not found")
+var errUnknownInvitee = errors.New("invitee doesn't have an account")
+var errInvalidInvite = errors.New("invalid invite")
+var errExpiredInvite = errors.New("invite has expired")
+var errTooManyAttempts = errors.New("too many wrong passwords, try again later")
+
+// colours a player can ask to play as
+const (
+	colourWhite  = "white"
+	colourBlack  = "black"
+	colourRandom = "random"
+)
+
+var errUnknownColour = errors.New("unknown colour")
+
+// parseColour validates a requested colour, no colour is white as clients that don't send one expect
+// the creator of a game to play white
+func parseColour(colour string) (string, error) {
+	switch colour {
+	case "":
+		return colourWhite, nil
+	case colourWhite, colourBlack, colourRandom:
+		return colour, nil
+	}
+
+	return "", errUnknownColour
+}
+
+// chooseColour returns the colour a player who asked for colour plays, random colours are decided here
+func chooseColour(colour string) int {
+	switch colour {
+	case colourWhite:
+		return c.White
+	case colourBlack:
+		return c.Black
+	}
+
+	return randomColour()
+}
+
+// randomColour returns white or black at random from crypto/rand, so the colours players get can't be
+// predicted, it falls back to white in the unlikely case crypto/rand fails
+func randomColour() int {
+	if n, err := randomInt(2); err == nil && n == 1 {
+		return c.Black
+	}
+
+	return c.White
+}
 
 func main() {
-	// disable logging in production
-	if PRODUCTION {
-		log.SetOutput(ioutil.Discard)
+	var err error
+	if cfg, err = config.Load(os.Args[1:]); err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:", err)
+		os.Exit(2)
+	}
+
+	if cfg.PrintConfig {
+		fmt.Print(cfg.YAML())
+		return
+	}
+
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logger = logging.New(os.Stderr, level, cfg.LogFormat)
+
+	registry = NewGameRegistry()
+	lobby = NewLobby()
+
+	// guests are matched as if they had a new rating
+	queue = NewMatchQueue(func(account string, tc *c.TimeControl) float64 {
+		if account == "" {
+			return ratings.DefaultRating
+		}
+
+		r, err := store.Rating(account, tc.Category())
+		if err != nil {
+			logger.Error("failed to load rating", "account", account, "err", err)
+		}
+
+		return r.Rating
+	}, startQueuedGame)
+	queue.Start(time.Second)
+
+	if store, err = storage.Open(cfg.Database); err != nil {
+		fatal("failed to open database", "path", cfg.Database, "err", err)
 	}
 
-	games = make(map[string]*c.GameController)
-	players = make(map[string]string)
+	// the session secret is saved so tokens stay valid across restarts unless one is provided
+	secret := []byte(cfg.SessionSecret)
+	if len(secret) == 0 {
+		if secret, err = store.Secret("session"); err != nil {
+			fatal("failed to load session secret", "err", err)
+		}
+	}
+	sessions = NewSessionSigner(secret, SESSION_TTL)
+
+	inviteSecret, err := store.Secret("invite")
+	if err != nil {
+		fatal("failed to load invite secret", "err", err)
+	}
+	invites = NewSessionSigner(inviteSecret, INVITE_TTL)
+
+	codes = NewCodeGenerator(cfg.GameCodes == config.CodesWords)
+	loadGames()
 
 	server := socketio.NewServer(nil)
 
 	server.OnError("/", func(s socketio.Conn, e error) {
-		log.Println("error: ", e)
+		logger.Error("socket error", "socket", s.ID(), "err", e)
 	})
 
 	server.OnConnect("/", func(s socketio.Conn) error {
-		players[s.ID()] = ""
+		registry.Connect(s.ID())
 
-		log.Println("connected: ", s.ID())
+		logger.Debug("connected", "socket", s.ID(), "event", "connect")
 		return nil
 	})
 
 	server.OnDisconnect("/", func(s socketio.Conn, reason string) {
+		// the games have been saved so players can rejoin them once the server is back up
+		if isShuttingDown() {
+			return
+		}
 
-		if players[s.ID()] != "" {
-			g, exists := games[players[s.ID()]]
-			if exists {
-				isOpponent := false
-				if g.Opponent != nil && g.Opponent.CompareID((s.ID())) {
-					isOpponent = true
-				}
-				leaveGame(s, players[s.ID()], isOpponent)
+		lobby.Disconnect(s.ID())
+		queue.Leave(s.ID())
+		chatLimiter.Forget(s.ID())
+		joinLimiter.Forget(s.ID())
+
+		playing, watching := registry.Disconnect(s.ID())
+		for _, code := range watching {
+			if g, exists := registry.Get(code); exists {
+				g.Unwatch(s.ID())
 			}
 		}
 
-		delete(players, s.ID())
+		for _, code := range playing {
+			g, exists := registry.Get(code)
+			if !exists {
+				continue
+			}
+
+			// correspondence games carry on without the player, they can rejoin them later
+			if g.IsCorrespondence() {
+				g.Disconnect(s.ID())
+				continue
+			}
+
+			// give players in live games a chance to rejoin before their opponent can claim the win
+			if g.IsStarted() && !g.IsEnded() {
+				if p := g.Disconnect(s.ID()); p != nil {
+					startGracePeriod(g, p)
+					gameLogger(g).Info("player disconnected", "socket", s.ID(), "event", "disconnect", "gracePeriod", cfg.GracePeriod.String())
+				}
+				continue
+			}
 
-		log.Println("closed", reason)
+			leaveGame(s, code)
+		}
+
+		logger.Debug("disconnected", "socket", s.ID(), "event", "disconnect", "reason", reason)
 	})
 
-	server.OnEvent("/", "game:create", func(s socketio.Conn, username string) string {
-		code := ""
-		for i := 0; i < 6; i++ {
-			var char rune = 'a' + rune(rand.Intn(25))
-			code += string(char)
+	// returns the game's code, the token the player uses to rejoin it, the colour they play
+	// and why the game couldn't be created, empty if it was
+	server.OnEvent("/", "game:create", func(s socketio.Conn, username string, options gameOptions) (string, string, string, string) {
+		l := eventLogger(s, "game:create").With("username", username)
+		fail := func(err error) (string, string, string, string) {
+			l.Warn("failed to create game", "err", err)
+			return "", "", "", err.Error()
 		}
 
-		if _, exists := games[code]; exists {
-			return ""
+		if isShuttingDown() {
+			return fail(errShuttingDown)
 		}
 
-		g := c.NewGame(code)
-		p := c.NewPlayer(username, false, s)
+		tc, err := newTimeControl(options)
+		if err != nil {
+			return fail(err)
+		}
+
+		colour, err := parseColour(options.Colour)
+		if err != nil {
+			return fail(err)
+		}
+
+		var invitee string
+		if options.Invitee != "" {
+			a, err := store.Account(options.Invitee)
+			if err == storage.ErrNotFound {
+				return fail(errUnknownInvitee)
+			} else if err != nil {
+				return fail(err)
+			}
+
+			invitee = a.Username
+		}
+
+		code, err := codes.Generate()
+		if err != nil {
+			return fail(err)
+		}
+
+		g := c.NewGame(code, tc)
+		p := newPlayer(s, username, chooseColour(colour), false)
 		g.You = p
+		g.OnEnd(onGameEnd)
+		g.SetRated(options.Rated)
+		g.ReserveSeat(invitee)
 
-		games[code] = g
-		players[s.ID()] = code
+		if err := g.SetPassword(options.Password); err != nil {
+			codes.Release(code)
+			return fail(err)
+		}
 
-		log.Printf("create game (%s): %s \n", username, code)
+		if !registry.Add(g) {
+			return fail(errCodeInUse)
+		}
+		registry.AddPlayerGame(s.ID(), code)
+		gamesCreated.Inc()
+		saveGame(g)
+
+		l.Info("created game", "game", code, "timeControl", tc.String())
 
-		return code
+		return code, sessions.Issue(code, p.Key()), c.ColorName(p.Color()), ""
 	})
 
-	server.OnEvent("/", "game:join", func(s socketio.Conn, username string, code string) string {
-		if _, exists := games[code]; !exists || games[code].Opponent != nil {
-			return ""
+	// takes the open seat of the game with code, private games need options' password or invite.
+	// The code can be left empty when joining with an invite
+	// returns the game's code, the token the player uses to rejoin it, the colour they play, the opposite
+	// of the colour the game's creator plays, and why they couldn't join, empty if they did
+	server.OnEvent("/", "game:join", func(s socketio.Conn, username string, code string, options joinOptions) (string, string, string, string) {
+		l := eventLogger(s, "game:join").With("username", username)
+		fail := func(err error) (string, string, string, string) {
+			l.Warn("failed to join game", "game", code, "err", err)
+			return "", "", "", err.Error()
+		}
+
+		if isShuttingDown() {
+			return fail(errShuttingDown)
+		}
+
+		var invite string
+		if options.Invite != "" {
+			inviteCode, key, err := invites.Verify(options.Invite)
+			if err == errExpiredToken {
+				return fail(errExpiredInvite)
+			} else if err != nil || (code != "" && code != inviteCode) {
+				return fail(errInvalidInvite)
+			}
+
+			code, invite = inviteCode, key
+		}
+
+		g, exists := registry.Get(code)
+		if !exists {
+			return fail(errGameNotFound)
+		}
+
+		// invites can't be guessed so only joining with a password is limited
+		if invite == "" && (joinLimiter.Limited(s.ID()) || gameJoinLimiter.Limited(code)) {
+			return fail(errTooManyAttempts)
 		}
 
-		g := games[code]
-		p := c.NewPlayer(username, true, s)
-		g.Opponent = p
+		// Join gives the player the colour the creator didn't take
+		p := newPlayer(s, username, c.White, true)
+		if err := g.Join(p, options.Password, invite); err != nil {
+			if err == c.ErrWrongPassword {
+				joinLimiter.Allow(s.ID())
+				gameJoinLimiter.Allow(code)
+			}
+
+			return fail(err)
+		}
 
 		g.StartGame()
-		g.BroadcastData()
+		broadcast(g)
+
+		registry.AddPlayerGame(s.ID(), code)
+		saveGame(g)
+
+		l.Info("joined game", "game", code)
+
+		return code, sessions.Issue(code, p.Key()), c.ColorName(p.Color()), ""
+	})
+
+	// creates a single use invite to the open seat of the player's game, it expires after INVITE_TTL
+	// returns the invite and why it couldn't be created, empty if it was
+	server.OnEvent("/", "game:invite", func(s socketio.Conn, code string) (string, string) {
+		g, exists := registry.Get(code)
+		if !exists {
+			return "", errGameNotFound.Error()
+		}
+
+		key, err := g.Invite(s.ID())
+		if err != nil {
+			return "", err.Error()
+		}
+		saveGame(g)
+
+		eventLogger(s, "game:invite").Info("created invite", "game", code)
+
+		return invites.Issue(code, key), ""
+	})
+
+	// posts an open challenge to the lobby
+	// returns the seek's id or "" if the options are invalid
+	server.OnEvent("/", "game:seek", func(s socketio.Conn, username string, options seekOptions) string {
+		account := socketAccount(s)
+		if account != "" {
+			username = account
+		}
+
+		if isShuttingDown() {
+			return ""
+		}
+
+		id, err := lobby.Post(newSocketConnection(s), username, account, options)
+		if err != nil {
+			eventLogger(s, "game:seek").Warn("failed to post seek", "username", username, "err", err)
+			return ""
+		}
+
+		eventLogger(s, "game:seek").Info("posted seek", "username", username, "seek", id)
+
+		return id
+	})
+
+	server.OnEvent("/", "game:cancel-seek", func(s socketio.Conn, id string) bool {
+		return lobby.Cancel(s.ID(), id)
+	})
+
+	// starts a game against the player who posted the seek, they are sent lobby:accepted. If the game
+	// can't be started the seek is put back in the lobby
+	// returns the game's code, the token the player uses to rejoin it, if the player is the opponent,
+	// the colour they play and why the seek couldn't be accepted, empty if it was
+	server.OnEvent("/", "lobby:accept", func(s socketio.Conn, username string, id string) (string, string, bool, string, string) {
+		l := eventLogger(s, "lobby:accept").With("username", username, "seek", id)
+		fail := func(err error) (string, string, bool, string, string) {
+			l.Warn("failed to accept seek", "err", err)
+			return "", "", false, "", err.Error()
+		}
+
+		if isShuttingDown() {
+			return fail(errShuttingDown)
+		}
+
+		seek, err := lobby.Accept(s.ID(), id)
+		if err != nil {
+			return fail(err)
+		}
+
+		seekerColour, colour := chooseColour(seek.Colour), c.White
+		if seekerColour == c.White {
+			colour = c.Black
+		}
+
+		seeker := connectionPlayer(seek.conn, seek.account, seek.Username, seekerColour, false)
+		p := newPlayer(s, username, colour, true)
+
+		code, err := startPairedGame(seek.tc, seek.Rated, seeker, p, func(code string) {
+			seek.conn.Emit("lobby:accepted", seatJSON(code, sessions.Issue(code, seeker.Key()), seeker))
+		})
+		if err != nil {
+			lobby.Restore(seek)
+			return fail(err)
+		}
+
+		l.Info("accepted seek", "game", code)
+
+		return code, sessions.Issue(code, p.Key()), p.IsOpponent(), c.ColorName(p.Color()), ""
+	})
+
+	// waits in the matchmaking queue for the time control in options, the socket is sent queue:matched
+	// once it is paired with a similarly rated player or queue:failed if their game couldn't be started
+	// returns false if the options are invalid
+	server.OnEvent("/", "queue:join", func(s socketio.Conn, username string, options gameOptions) bool {
+		if isShuttingDown() {
+			return false
+		}
+
+		tc, err := newTimeControl(options)
+		if err != nil {
+			eventLogger(s, "queue:join").Warn("failed to join queue", "username", username, "err", err)
+			return false
+		}
+
+		account := socketAccount(s)
+		if account != "" {
+			username = account
+		}
+
+		queue.Join(newSocketConnection(s), username, account, tc)
+		eventLogger(s, "queue:join").Info("joined queue", "username", username, "pool", poolKey(tc))
+
+		return true
+	})
+
+	server.OnEvent("/", "queue:leave", func(s socketio.Conn) bool {
+		return queue.Leave(s.ID())
+	})
+
+	// sends the open seeks with lobby:list now and whenever they change
+	server.OnEvent("/", "lobby:subscribe", func(s socketio.Conn) {
+		lobby.Subscribe(newSocketConnection(s))
+	})
+
+	server.OnEvent("/", "lobby:unsubscribe", func(s socketio.Conn) {
+		lobby.Unsubscribe(s.ID())
+	})
+
+	// rebinds the player the token was issued to to this socket, e.g. after a page refresh
+	// returns the game's code, if the player is the opponent, a refreshed token and the colour they play
+	server.OnEvent("/", "game:rejoin", func(s socketio.Conn, token string) (string, bool, string, string) {
+		// reopening a game that shutdown has paused and saved would resume it
+		if isShuttingDown() {
+			return "", false, "", ""
+		}
+
+		code, key, err := sessions.Verify(token)
+		if err != nil {
+			eventLogger(s, "game:rejoin").Warn("invalid session token", "err", err)
+			return "", false, "", ""
+		}
+
+		g, exists := registry.Get(code)
+		if !exists {
+			return "", false, "", ""
+		}
+
+		p := g.Open(key, newSocketConnection(s))
+		if p == nil {
+			return "", false, "", ""
+		}
+
+		registry.AddPlayerGame(s.ID(), code)
+		broadcast(g)
+
+		eventLogger(s, "game:rejoin").Info("rejoined game", "game", code)
+
+		return code, p.IsOpponent(), sessions.Issue(code, key), c.ColorName(p.Color())
+	})
+
+	// ends the game in the player's favour once their opponent's grace period has run out
+	server.OnEvent("/", "game:claim-win", func(s socketio.Conn, code string) bool {
+		g, exists := registry.Get(code)
+		if !exists || !g.ClaimWin(s.ID(), cfg.GracePeriod) {
+			return false
+		}
+
+		broadcast(g)
+		eventLogger(s, "game:claim-win").Info("claimed win", "game", code)
+
+		return true
+	})
+
+	// subscribes the socket to the game as a spectator, it is sent the game's state straight away.
+	// username is shown on the spectator's chat messages. Private rooms can't be watched
+	server.OnEvent("/", "game:watch", func(s socketio.Conn, code string, username string) bool {
+		g, exists := registry.Get(code)
+		if !exists {
+			return false
+		}
+
+		if account := socketAccount(s); account != "" {
+			username = account
+		} else if username == "" {
+			username = "spectator"
+		}
 
-		players[s.ID()] = code
+		if err := g.Watch(newSocketConnection(s), username); err != nil {
+			eventLogger(s, "game:watch").Warn("refused spectator", "game", code, "err", err)
+			return false
+		}
+		registry.AddSpectatorGame(s.ID(), code)
+
+		eventLogger(s, "game:watch").Info("watching game", "game", code)
+
+		return true
+	})
+
+	server.OnEvent("/", "game:unwatch", func(s socketio.Conn, code string) bool {
+		g, exists := registry.Get(code)
+		if !exists {
+			return false
+		}
+
+		registry.RemoveSpectatorGame(s.ID(), code)
+		return g.Unwatch(s.ID())
+	})
+
+	// sends a chat message to the other players or, from a spectator, to the other spectators
+	server.OnEvent("/", "game:chat", func(s socketio.Conn, code string, text string) bool {
+		g, exists := registry.Get(code)
+		if !exists {
+			return false
+		}
+
+		if !chatLimiter.Allow(s.ID()) {
+			eventLogger(s, "game:chat").Warn("chat rate limited", "game", code)
+			return false
+		}
+
+		if err := g.Chat(s.ID(), text); err != nil {
+			eventLogger(s, "game:chat").Warn("failed to send chat message", "game", code, "err", err)
+			return false
+		}
+
+		saveGame(g)
+		return true
+	})
+
+	// stops or starts sending the opponent's chat messages to the player
+	server.OnEvent("/", "game:mute", func(s socketio.Conn, code string, muted bool) bool {
+		g, exists := registry.Get(code)
+		if !exists {
+			return false
+		}
+
+		if !g.Mute(s.ID(), muted) {
+			return false
+		}
+
+		saveGame(g)
+		return true
+	})
+
+	// offers the opponent a rematch once the game has ended, if they have already offered one it starts
+	server.OnEvent("/", "game:rematch-offer", func(s socketio.Conn, code string) bool {
+		g, exists := registry.Get(code)
+		if !exists {
+			return false
+		}
+
+		accepted, err := g.OfferRematch(s.ID())
+		if err != nil {
+			eventLogger(s, "game:rematch-offer").Warn("failed to offer rematch", "game", code, "err", err)
+			return false
+		}
+
+		if accepted {
+			return startRematch(g) != ""
+		}
+
+		return true
+	})
+
+	// starts the rematch the opponent offered, both players are sent game:rematch with their seat in it
+	// returns the new game's code, the token the player uses to rejoin it and if the player is the opponent
+	server.OnEvent("/", "game:rematch-accept", func(s socketio.Conn, code string) (string, string, bool) {
+		g, exists := registry.Get(code)
+		if !exists {
+			return "", "", false
+		}
+
+		if err := g.AcceptRematch(s.ID()); err != nil {
+			eventLogger(s, "game:rematch-accept").Warn("failed to accept rematch", "game", code, "err", err)
+			return "", "", false
+		}
+
+		newCode := startRematch(g)
+		if newCode == "" {
+			return "", "", false
+		}
 
-		log.Printf("join game (%s): %s \n", username, code)
+		rematch, _ := registry.Get(newCode)
+		p := rematch.PlayerWithID(s.ID())
+		if p == nil {
+			return "", "", false
+		}
 
-		return code
+		return newCode, sessions.Issue(newCode, p.Key()), p.IsOpponent()
 	})
 
+	// moves aren't accepted once the server is shutting down since the game has already been saved,
+	// the game is paused before it is saved so a move that is already being made is rejected by the game
 	server.OnEvent("/", "game:move", func(s socketio.Conn, code string, file, rank, dFile, dRank, promotion int) bool {
-		if _, exists := games[code]; !exists {
+		g, exists := registry.Get(code)
+		if !exists || isShuttingDown() {
 			return false
 		}
 
-		g := games[code]
-		madeMove := false
-		if (g.You.CompareID(s.ID()) && g.IsCurrentlyPlaying(g.You)) || (g.Opponent.CompareID(s.ID()) && g.IsCurrentlyPlaying(g.Opponent)) {
-			madeMove = g.MakeMove(file, rank, dFile, dRank, promotion)
+		start := time.Now()
+		madeMove := g.MakePlayerMove(s.ID(), file, rank, dFile, dRank, promotion)
+		observeValidation("MakeMove", start)
+
+		if madeMove {
+			movesMade.Inc()
+			saveGame(g)
 		}
 
-		g.BroadcastData()
-		log.Printf("made move (%s): (%d, %d) (%d, %d) \n", code, file, rank, dFile, dRank)
+		broadcast(g)
+		eventLogger(s, "game:move").Debug("move", "game", code, "from", []int{file, rank}, "to", []int{dFile, dRank}, "made", madeMove)
 
 		return madeMove
 	})
 
 	server.OnEvent("/", "game:valid-moves", func(s socketio.Conn, code string, file, rank int) string {
-		if _, exists := games[code]; !exists {
+		g, exists := registry.Get(code)
+		if !exists {
 			return "[]"
 		}
 
-		g := games[code]
-		moves := []c.Spot{}
-		if g.You.CompareID(s.ID()) {
-			moves = g.GetValidMoves(file, rank, c.Black)
-		} else if g.Opponent.CompareID(s.ID()) {
-			moves = g.GetValidMoves(file, rank, c.White)
-		}
+		start := time.Now()
+		moves := g.GetPlayerValidMoves(s.ID(), file, rank)
+		observeValidation("GetValidMoves", start)
 
 		if moves != nil {
 			json := "["
@@ -148,26 +712,36 @@ func main() {
 		}
 	})
 
+	server.OnEvent("/", "clock:pong", func(s socketio.Conn, code string, ping int) bool {
+		g, exists := registry.Get(code)
+		if !exists {
+			return false
+		}
+
+		return g.Pong(s.ID(), ping)
+	})
+
+	// isOpponent is still sent by clients but the player is found from their socket
 	server.OnEvent("/", "game:leave", func(s socketio.Conn, code string, isOpponent bool) bool {
-		return leaveGame(s, code, isOpponent)
+		return leaveGame(s, code)
 	})
 
 	go server.Serve()
-	defer server.Close()
 
 	mux := http.NewServeMux()
 	mux.Handle("/socket.io/", server)
-
-	port := ":8000"
-	allowedOrigins := []string{"http://localhost:8080", "http://192.168.1.84:8080"}
-
-	if PRODUCTION {
-		port = ":" + os.Getenv("PORT")
-		allowedOrigins = []string{"https://scuffedchess.netlify.app", "https://scuffedchess.online", "https://www.scuffedchess.online"}
-	}
+	mux.HandleFunc("/api/register", handleRegister)
+	mux.HandleFunc("/api/login", handleLogin)
+	mux.HandleFunc("/api/logout", handleLogout)
+	mux.HandleFunc("/api/account", handleAccount)
+	mux.HandleFunc("/api/games", handleArchivedGames)
+	mux.HandleFunc("/api/games/", handleArchivedGame)
+	mux.Handle("/metrics", serverMetrics.Handler())
+	mux.HandleFunc("/healthz", handleHealth)
+	mux.HandleFunc("/readyz", handleReady)
 
 	c := cors.New(cors.Options{
-		AllowedOrigins:   allowedOrigins,
+		AllowedOrigins:   cfg.AllowedOrigins,
 		AllowCredentials: true,
 		// Enable Debugging for testing, consider disabling in production
 		Debug: false,
@@ -175,38 +749,369 @@ func main() {
 
 	handler := c.Handler(mux)
 
-	fmt.Println("Serving at localhost" + port)
-	fmt.Println(http.ListenAndServe(port, handler))
+	httpServer := &http.Server{Addr: cfg.Listen, Handler: handler}
+	go func() {
+		if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+			fatal("server stopped", "err", err)
+		}
+	}()
+	logger.Info("serving", "listen", cfg.Listen)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	logger.Info("received signal", "signal", (<-signals).String())
+
+	shutdown(httpServer, server)
+}
+
+// seatJSON returns the data sent to a player who has been seated in a game they didn't create or join themselves
+func seatJSON(code string, token string, p *c.Player) string {
+	data, _ := json.Marshal(struct {
+		Code       string `json:"code"`
+		Token      string `json:"token"`
+		IsOpponent bool   `json:"isOpponent"`
+		Colour     string `json:"colour"`
+	}{code, token, p.IsOpponent(), c.ColorName(p.Color())})
+
+	return string(data)
+}
+
+// startPairedGame creates and starts a game between you and opponent, who already have their colours,
+// beforeStart is called with the game's code once it is registered so the players can be told about it
+// before the game's data is broadcast
+// @returns the game's code or why it couldn't be created
+func startPairedGame(tc *c.TimeControl, rated bool, you, opponent *c.Player, beforeStart func(code string)) (string, error) {
+	if isShuttingDown() {
+		return "", errShuttingDown
+	}
+
+	code, err := codes.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	g := c.NewGame(code, tc)
+	g.You, g.Opponent = you, opponent
+	g.OnEnd(onGameEnd)
+	g.SetRated(rated)
+	if !registry.Add(g) {
+		return "", errCodeInUse
+	}
+	gamesCreated.Inc()
+	registry.AddPlayerGame(you.Connection().ID(), code)
+	registry.AddPlayerGame(opponent.Connection().ID(), code)
+
+	beforeStart(code)
+
+	g.StartGame()
+	broadcast(g)
+	saveGame(g)
+
+	return code, nil
+}
+
+// startRematch creates and starts the rematch of a finished game, moving its players into the rematch
+// and removing the finished game
+// @returns the rematch's code or "" if it couldn't be created
+func startRematch(g *c.GameController) string {
+	if isShuttingDown() {
+		return ""
+	}
+
+	code, err := codes.Generate()
+	if err != nil {
+		gameLogger(g).Error("failed to create rematch", "err", err)
+		return ""
+	}
+
+	rematch := g.Rematch(code)
+	if rematch == nil {
+		codes.Release(code)
+		return ""
+	}
+	if !registry.Add(rematch) {
+		gameLogger(g).Error("failed to create rematch", "rematch", code, "err", errCodeInUse)
+		return ""
+	}
+	gamesCreated.Inc()
+
+	for _, p := range []*c.Player{rematch.White(), rematch.Black()} {
+		conn := p.Connection()
+		if conn == nil {
+			continue
+		}
+
+		registry.RemovePlayerGame(conn.ID(), g.Code())
+		registry.AddPlayerGame(conn.ID(), code)
+		conn.Emit("game:rematch", seatJSON(code, sessions.Issue(code, p.Key()), p))
+	}
+	removeGame(g)
+
+	rematch.StartGame()
+	broadcast(rematch)
+	saveGame(rematch)
+
+	gameLogger(g).Info("started rematch", "rematch", code)
+
+	return code
+}
+
+// startQueuedGame starts a rated game between two players matched by the queue with random colours,
+// if it can't be started both players are sent queue:failed with the reason
+func startQueuedGame(a, b *queueEntry) {
+	if randomColour() == c.Black {
+		a, b = b, a
+	}
+
+	white := connectionPlayer(a.conn, a.account, a.username, c.White, false)
+	black := connectionPlayer(b.conn, b.account, b.username, c.Black, true)
+
+	code, err := startPairedGame(a.tc, true, white, black, func(code string) {
+		white.Connection().Emit("queue:matched", seatJSON(code, sessions.Issue(code, white.Key()), white))
+		black.Connection().Emit("queue:matched", seatJSON(code, sessions.Issue(code, black.Key()), black))
+	})
+	if err != nil {
+		logger.Error("failed to start queued game", "white", a.username, "black", b.username, "err", err)
+
+		// the players have left the queue so they are told to join it again
+		a.conn.Emit("queue:failed", err.Error())
+		b.conn.Emit("queue:failed", err.Error())
+		return
+	}
+
+	logger.Info("matched", "game", code, "white", a.username, "black", b.username)
+}
+
+// newTimeControl creates the time control described by the options sent with game:create
+func newTimeControl(options gameOptions) (*c.TimeControl, error) {
+	// CorrespondenceTimeControl rejects days per move that are out of range
+	if options.TimeMode == "correspondence" {
+		return c.CorrespondenceTimeControl(options.DaysPerMove)
+	}
+
+	tc, err := cfg.TimeControl()
+	if options.TimeControl != "" {
+		tc, err = c.ParseTimeControl(options.TimeControl, options.Delay)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tc.SetMode(options.TimeMode, options.BlackTimeControl); err != nil {
+		return nil, err
+	}
+
+	return tc, nil
+}
+
+// loadGames restores the games saved in the database. Players of live games have a grace period to
+// rejoin them, finished live games are deleted since nobody can rejoin them and live games that hadn't
+// started are deleted since their creator has gone and nobody should be able to join them. Their codes
+// aren't reserved so they can be given to new games
+func loadGames() {
+	snapshots, err := store.LoadGames()
+	if err != nil {
+		fatal("failed to load games", "err", err)
+	}
+
+	for _, snapshot := range snapshots {
+		g, err := c.RestoreGame(snapshot)
+		if err != nil {
+			logger.Error("failed to restore game", "game", snapshot.Code, "err", err)
+			continue
+		}
+
+		if !g.IsCorrespondence() && (g.IsEnded() || !g.IsStarted()) {
+			if err := store.DeleteGame(g.Code()); err != nil {
+				gameLogger(g).Error("failed to delete game", "err", err)
+			}
+			continue
+		}
+
+		g.OnEnd(onGameEnd)
+		if !registry.Add(g) {
+			gameLogger(g).Error("failed to restore game", "err", errCodeInUse)
+			continue
+		}
+		codes.Reserve(g.Code())
+
+		if !g.IsCorrespondence() {
+			startGracePeriod(g, g.White())
+			startGracePeriod(g, g.Black())
+		}
+	}
+
+	logger.Info("restored games", "games", registry.Len())
+}
+
+// endingGames counts the games that have ended but haven't been saved, rated and archived yet
+var endingGames int32
+
+// onGameEnd is called with the game locked as soon as it ends, the game is counted as ending before
+// gameEnded starts so shutdown can't miss it
+func onGameEnd(g *c.GameController) {
+	atomic.AddInt32(&endingGames, 1)
+	go func() {
+		defer atomic.AddInt32(&endingGames, -1)
+		gameEnded(g)
+	}()
+}
+
+// gameEnded is called when a game finishes
+func gameEnded(g *c.GameController) {
+	gamesFinished.Inc(g.EndState())
+	saveGame(g)
+	rateGame(g)
+	archiveGame(g)
+}
+
+// rateGame updates the Glicko-2 ratings of the players of a rated game in its time control's category,
+// game:result is broadcast again with the rating changes. Only games between two different accounts
+// are rated. Games where a player didn't move and games both players abandoned aren't rated
+func rateGame(g *c.GameController) {
+	white, black := g.White(), g.Black()
+	if !g.IsRated() || g.MoveCount() < 2 || white == nil || black == nil {
+		return
+	}
+
+	// nobody played out an abandoned game or a disconnect that nobody won
+	endState := g.EndState()
+	if endState == c.EndAbandoned || (endState == c.EndDisconnect && g.Winner() == c.Draw) {
+		gameLogger(g).Info("not rating game, it was abandoned", "endState", endState)
+		return
+	}
+
+	whiteAccount, blackAccount := white.Account(), black.Account()
+	if whiteAccount == "" || blackAccount == "" || whiteAccount == blackAccount {
+		gameLogger(g).Info("not rating game, both players must be logged in to different accounts")
+		return
+	}
+
+	ratingsMu.Lock()
+	defer ratingsMu.Unlock()
+
+	category := g.TimeControl().Category()
+	whiteRating, err := store.Rating(whiteAccount, category)
+	if err != nil {
+		gameLogger(g).Error("failed to load rating", "account", whiteAccount, "err", err)
+		return
+	}
+	blackRating, err := store.Rating(blackAccount, category)
+	if err != nil {
+		gameLogger(g).Error("failed to load rating", "account", blackAccount, "err", err)
+		return
+	}
+
+	score := ratings.Draw
+	switch g.Winner() {
+	case c.White:
+		score = ratings.Win
+	case c.Black:
+		score = ratings.Loss
+	}
+
+	newWhite := ratings.Update(whiteRating, blackRating, score)
+	newBlack := ratings.Update(blackRating, whiteRating, 1-score)
+
+	err = store.SaveRatings(category, map[string]ratings.Rating{whiteAccount: newWhite, blackAccount: newBlack})
+	if err != nil {
+		gameLogger(g).Error("failed to save ratings", "err", err)
+		return
+	}
+
+	g.SetRatingChanges(ratingChange(whiteRating, newWhite), ratingChange(blackRating, newBlack))
+	broadcast(g)
+
+	gameLogger(g).Info("rated game",
+		"white", whiteAccount, "whiteRating", math.Round(whiteRating.Rating), "newWhiteRating", math.Round(newWhite.Rating),
+		"black", blackAccount, "blackRating", math.Round(blackRating.Rating), "newBlackRating", math.Round(newBlack.Rating))
+}
+
+func ratingChange(before, after ratings.Rating) c.RatingChange {
+	rating := int(math.Round(after.Rating))
+	return c.RatingChange{Rating: rating, Change: rating - int(math.Round(before.Rating)), Provisional: after.Provisional()}
+}
+
+// saveGame snapshots a game to the database so it survives restarts, games that have been removed aren't saved
+func saveGame(g *c.GameController) {
+	persistMu.Lock()
+	defer persistMu.Unlock()
+
+	if registered, exists := registry.Get(g.Code()); !exists || registered != g {
+		return
+	}
+
+	if err := store.SaveGame(g.Snapshot()); err != nil {
+		gameLogger(g).Error("failed to save game", "err", err)
+	}
 }
 
-func leaveGame(s socketio.Conn, code string, isOpponent bool) bool {
-	if _, exists := games[code]; !exists {
+// removeGame unregisters and stops a game and deletes it from the database, finished games have already
+// been archived so its code can be given to a new game
+// @returns wether the game was registered
+func removeGame(g *c.GameController) bool {
+	persistMu.Lock()
+	defer persistMu.Unlock()
+
+	if !registry.Remove(g.Code()) {
 		return false
 	}
+	codes.Release(g.Code())
+	gameJoinLimiter.Forget(g.Code())
 
-	g := games[code]
-	delete(games, code)
+	g.Stop()
+	if err := store.DeleteGame(g.Code()); err != nil {
+		gameLogger(g).Error("failed to delete game", "err", err)
+	}
 
-	players[s.ID()] = ""
+	return true
+}
 
-	left := false
-	if isOpponent && g.Opponent != nil && g.Opponent.CompareID(s.ID()) {
-		g.Opponent = nil
+// startGracePeriod gives p the configured grace period to rejoin g, afterwards their opponent can claim
+// the win or the game is abandoned if the opponent has gone too
+func startGracePeriod(g *c.GameController, p *c.Player) {
+	time.AfterFunc(cfg.GracePeriod, func() {
+		if isShuttingDown() || !g.GraceExpired(p, cfg.GracePeriod) {
+			return
+		}
 
-		os := g.You.GetSocket()
-		os.Emit("game:end-state", "disconnect")
-		players[os.ID()] = ""
+		removeGame(g)
 
-		left = true
-	} else if g.You != nil && g.You.CompareID((s.ID())) {
-		g.You = nil
+		gameLogger(g).Info("abandoned game")
+	})
+}
 
-		os := g.You.GetSocket()
-		os.Emit("game:end-state", "disconnect")
-		players[os.ID()] = ""
+func leaveGame(s socketio.Conn, code string) bool {
+	g, exists := registry.Get(code)
+	if !exists {
+		return false
+	}
 
-		left = true
+	// leaving a correspondence game just closes it, it is only deleted once it has ended
+	if g.IsCorrespondence() {
+		g.Disconnect(s.ID())
+		registry.RemovePlayerGame(s.ID(), code)
+
+		if g.IsEnded() {
+			removeGame(g)
+		}
+
+		return true
+	}
+
+	left, remaining := g.Leave(s.ID())
+	if !left {
+		return false
+	}
+
+	removeGame(g)
+	registry.RemovePlayerGame(s.ID(), code)
+
+	if remaining != nil {
+		if conn := remaining.Connection(); conn != nil {
+			registry.RemovePlayerGame(conn.ID(), code)
+		}
 	}
 
-	return left
+	return true
 }
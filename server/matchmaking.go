@@ -0,0 +1,162 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+)
+
+// the rating window players are matched within starts at matchWindow and widens by matchWindowGrowth
+// every second a player waits, up to matchWindowMax
+const (
+	matchWindow       = 100
+	matchWindowGrowth = 10
+	matchWindowMax    = 600
+)
+
+// queueEntry is a player waiting in the matchmaking queue
+type queueEntry struct {
+	username string
+	account  string
+	conn     c.Connection
+	tc       *c.TimeControl
+	rating   float64
+	joinedAt time.Time
+}
+
+// window returns how far the entry's opponent's rating can be from its own at now
+func (e *queueEntry) window(now time.Time) float64 {
+	waited := now.Sub(e.joinedAt).Seconds()
+	return math.Min(matchWindow+matchWindowGrowth*waited, matchWindowMax)
+}
+
+// MatchQueue pairs players waiting for the same time control whose ratings are close enough,
+// it is safe for concurrent use
+type MatchQueue struct {
+	mu sync.Mutex
+
+	// pools maps time control pools to the players waiting in them, oldest first
+	pools map[string][]*queueEntry
+
+	rating  func(account string, tc *c.TimeControl) float64
+	onMatch func(a, b *queueEntry)
+	ticker  *time.Ticker
+}
+
+// NewMatchQueue creates an empty queue, rating looks up an account's rating in a time control and
+// onMatch is called with each pair of players that is matched
+func NewMatchQueue(rating func(account string, tc *c.TimeControl) float64, onMatch func(a, b *queueEntry)) *MatchQueue {
+	return &MatchQueue{
+		pools:   make(map[string][]*queueEntry),
+		rating:  rating,
+		onMatch: onMatch,
+	}
+}
+
+// Start rechecks the queue every interval so players are matched as their rating windows widen
+func (q *MatchQueue) Start(interval time.Duration) {
+	q.ticker = time.NewTicker(interval)
+
+	go func() {
+		for range q.ticker.C {
+			q.match()
+		}
+	}()
+}
+
+// Join adds the player connected on conn to the pool for tc, a connection can only wait in one pool.
+// account is empty for guests
+func (q *MatchQueue) Join(conn c.Connection, username string, account string, tc *c.TimeControl) {
+	e := &queueEntry{username, account, conn, tc, q.rating(account, tc), time.Now()}
+
+	q.mu.Lock()
+	q.remove(conn.ID())
+	pool := poolKey(tc)
+	q.pools[pool] = append(q.pools[pool], e)
+	q.mu.Unlock()
+
+	q.match()
+}
+
+// Leave removes the socket with id from the queue
+// @returns wether the socket was waiting
+func (q *MatchQueue) Leave(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.remove(id)
+}
+
+func (q *MatchQueue) remove(id string) bool {
+	for pool, entries := range q.pools {
+		for i, e := range entries {
+			if e.conn.ID() == id {
+				q.pools[pool] = append(entries[:i:i], entries[i+1:]...)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// match pairs off every player in each pool with the closest rated player they are both in the window of,
+// players who have waited the longest are matched first
+func (q *MatchQueue) match() {
+	q.mu.Lock()
+
+	now := time.Now()
+	var matches [][2]*queueEntry
+
+	for pool, entries := range q.pools {
+		waiting := make([]*queueEntry, 0, len(entries))
+		matched := make(map[*queueEntry]bool)
+
+		for i, e := range entries {
+			if matched[e] {
+				continue
+			}
+
+			var best *queueEntry
+			for _, o := range entries[i+1:] {
+				diff := math.Abs(e.rating - o.rating)
+				if matched[o] || diff > e.window(now) || diff > o.window(now) {
+					continue
+				}
+
+				if best == nil || diff < math.Abs(e.rating-best.rating) {
+					best = o
+				}
+			}
+
+			if best == nil {
+				waiting = append(waiting, e)
+				continue
+			}
+
+			matched[e], matched[best] = true, true
+			matches = append(matches, [2]*queueEntry{e, best})
+		}
+
+		q.pools[pool] = waiting
+	}
+
+	q.mu.Unlock()
+
+	for _, m := range matches {
+		q.onMatch(m[0], m[1])
+	}
+}
+
+// poolKey returns the pool players waiting for tc are matched in, only players with identical
+// time controls are paired
+func poolKey(tc *c.TimeControl) string {
+	key := tc.ModeName() + " " + tc.String() + " " + tc.DelayName()
+	if tc.Mode == c.Armageddon {
+		key += " " + tc.BlackString()
+	}
+
+	return key
+}
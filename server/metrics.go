@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/metrics"
+)
+
+// serverMetrics are the metrics served on /metrics
+var serverMetrics = metrics.NewRegistry()
+
+var (
+	gamesCreated  = serverMetrics.NewCounter("scuffed_chess_games_created_total", "Games created.")
+	gamesFinished = serverMetrics.NewCounterVec("scuffed_chess_games_finished_total", "Games finished by how they ended.", "reason")
+	movesMade     = serverMetrics.NewCounter("scuffed_chess_moves_total", "Moves made, its rate is the moves made per second.")
+	// socket.io doesn't report failed emits so this counts the updates players missed while disconnected
+	broadcastsToDisconnected = serverMetrics.NewCounter("scuffed_chess_broadcasts_to_disconnected_total", "Game updates a seated player wasn't sent because they were disconnected.")
+
+	// validation of a move usually takes well under a millisecond, the buckets go from 10µs to about 2.6s
+	moveValidation = serverMetrics.NewHistogramVec("scuffed_chess_move_validation_seconds", "Time taken to validate moves.", "op",
+		metrics.ExponentialBuckets(0.00001, 4, 10))
+)
+
+func init() {
+	serverMetrics.NewGaugeFunc("scuffed_chess_sockets_connected", "Sockets connected.", func() float64 {
+		return float64(registry.Sockets())
+	})
+	serverMetrics.NewGaugeFunc("scuffed_chess_spectators", "Sockets watching games.", func() float64 {
+		spectators := 0
+		for _, g := range registry.Games() {
+			spectators += g.Spectators()
+		}
+
+		return float64(spectators)
+	})
+	serverMetrics.NewGaugeFunc("scuffed_chess_games_active", "Games that haven't been removed yet, including finished games waiting for a rematch.", func() float64 {
+		return float64(registry.Len())
+	})
+}
+
+// observeValidation records how long the move validation op, which started at start, took
+func observeValidation(op string, start time.Time) {
+	moveValidation.Observe(op, time.Since(start).Seconds())
+}
+
+// broadcast sends g's state to its players and spectators, counting the players who were disconnected
+func broadcast(g *c.GameController) {
+	if disconnected := g.BroadcastData(); disconnected > 0 {
+		broadcastsToDisconnected.Add(float64(disconnected))
+	}
+}
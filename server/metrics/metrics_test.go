@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHandlerOutput checks every kind of metric is served in the Prometheus text format
+func TestHandlerOutput(t *testing.T) {
+	r := NewRegistry()
+
+	games := r.NewCounter("games_total", "Games created.")
+	games.Inc()
+	games.Add(2.5)
+
+	finished := r.NewCounterVec("finished_total", "Games finished.", "reason")
+	finished.Inc("timeout")
+	finished.Inc("checkmate")
+	finished.Inc("timeout")
+	finished.Inc(`bad "reason"` + "\\\n")
+
+	r.NewGaugeFunc("sockets", "Sockets connected.", func() float64 {
+		return 3
+	})
+
+	validation := r.NewHistogramVec("validation_seconds", "Validation time.", "op", []float64{0.01, 0.1})
+	validation.Observe("MakeMove", 0.005)
+	validation.Observe("MakeMove", 0.05)
+	validation.Observe("MakeMove", 1)
+
+	want := `# HELP games_total Games created.
+# TYPE games_total counter
+games_total 3.5
+# HELP finished_total Games finished.
+# TYPE finished_total counter
+finished_total{reason="bad \"reason\"\\\n"} 1
+finished_total{reason="checkmate"} 1
+finished_total{reason="timeout"} 2
+# HELP sockets Sockets connected.
+# TYPE sockets gauge
+sockets 3
+# HELP validation_seconds Validation time.
+# TYPE validation_seconds histogram
+validation_seconds_bucket{op="MakeMove",le="0.01"} 1
+validation_seconds_bucket{op="MakeMove",le="0.1"} 2
+validation_seconds_bucket{op="MakeMove",le="+Inf"} 3
+validation_seconds_sum{op="MakeMove"} 1.055
+validation_seconds_count{op="MakeMove"} 3
+`
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("content type is %q", contentType)
+	}
+
+	body, _ := ioutil.ReadAll(w.Body)
+	if string(body) != want {
+		t.Fatalf("served\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	buckets := ExponentialBuckets(1, 2, 4)
+
+	want := []float64{1, 2, 4, 8}
+	if len(buckets) != len(want) {
+		t.Fatalf("buckets are %v, want %v", buckets, want)
+	}
+	for i := range want {
+		if buckets[i] != want[i] {
+			t.Fatalf("buckets are %v, want %v", buckets, want)
+		}
+	}
+}
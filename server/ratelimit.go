@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter limits how often each socket, or anything else with an id such as a game, can do something
+// with a token bucket per id, it is safe for concurrent use
+type RateLimiter struct {
+	mu sync.Mutex
+
+	burst    float64
+	interval time.Duration
+	buckets  map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing bursts of up to burst actions, refilling one every interval
+func NewRateLimiter(burst int, interval time.Duration) *RateLimiter {
+	return &RateLimiter{burst: float64(burst), interval: interval, buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow takes a token from the socket with id's bucket
+// @returns false if the bucket is empty and the socket should be limited
+func (r *RateLimiter) Allow(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b := r.bucket(id)
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// Limited returns true if the socket with id's bucket is empty without taking a token, so only failed
+// attempts need to be counted with Allow
+func (r *RateLimiter) Limited(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.bucket(id).tokens < 1
+}
+
+// bucket returns the socket with id's bucket, refilled for the time since it was last used
+func (r *RateLimiter) bucket(id string) *tokenBucket {
+	now := time.Now()
+	b, exists := r.buckets[id]
+	if !exists {
+		b = &tokenBucket{r.burst, now}
+		r.buckets[id] = b
+	}
+
+	b.tokens += float64(now.Sub(b.last)) / float64(r.interval)
+	if b.tokens > r.burst {
+		b.tokens = r.burst
+	}
+	b.last = now
+
+	return b
+}
+
+// Forget removes the socket with id's bucket once it has disconnected
+func (r *RateLimiter) Forget(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.buckets, id)
+}
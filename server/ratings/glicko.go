@@ -0,0 +1,122 @@
+// Package ratings implements the Glicko-2 rating system, each rated game is treated as its own rating period
+package ratings
+
+import "math"
+
+// Defaults for players who haven't played a rated game yet
+const (
+	DefaultRating     = 1500
+	DefaultDeviation  = 350
+	DefaultVolatility = 0.06
+)
+
+// ProvisionalDeviation is the deviation above which a rating is provisional, i.e. not yet reliable
+const ProvisionalDeviation = 110
+
+// MinDeviation stops deviations shrinking so far that ratings barely move
+const MinDeviation = 45
+
+const (
+	// tau constrains how much volatility can change each rating period
+	tau = 0.5
+	// scale converts between the Glicko and Glicko-2 scales
+	scale = 173.7178
+	// epsilon is the precision volatility is calculated to
+	epsilon = 0.000001
+)
+
+// Scores a game can end with for a player
+const (
+	Loss = 0
+	Draw = 0.5
+	Win  = 1
+)
+
+// Rating is a player's Glicko-2 rating in one category
+type Rating struct {
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+	Games      int     `json:"games"`
+}
+
+// NewRating returns the rating of a player who hasn't played a rated game yet
+func NewRating() Rating {
+	return Rating{DefaultRating, DefaultDeviation, DefaultVolatility, 0}
+}
+
+// Provisional returns true if the rating is not yet reliable
+func (r Rating) Provisional() bool {
+	return r.Deviation > ProvisionalDeviation
+}
+
+// Update returns r after a game against opponent where r scored score, Win, Draw or Loss
+func Update(r Rating, opponent Rating, score float64) Rating {
+	mu, phi := toGlicko2(r)
+	muJ, phiJ := toGlicko2(opponent)
+
+	gJ := g(phiJ)
+	e := expected(mu, muJ, gJ)
+	v := 1 / (gJ * gJ * e * (1 - e))
+	delta := v * gJ * (score - e)
+
+	sigma := volatility(phi, r.Volatility, v, delta)
+
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * gJ * (score - e)
+
+	deviation := math.Max(MinDeviation, math.Min(phi*scale, DefaultDeviation))
+
+	return Rating{mu*scale + DefaultRating, deviation, sigma, r.Games + 1}
+}
+
+func toGlicko2(r Rating) (float64, float64) {
+	return (r.Rating - DefaultRating) / scale, r.Deviation / scale
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expected(mu, muJ, gJ float64) float64 {
+	return 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+}
+
+// volatility finds the new volatility with the Illinois algorithm, step 5 of the Glicko-2 paper
+func volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(tau*tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*tau) < 0 {
+			k++
+		}
+		B = a - k*tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
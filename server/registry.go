@@ -0,0 +1,170 @@
+package main
+
+import (
+	"sync"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+)
+
+// GameRegistry tracks the games on the server and the sockets playing them, it is safe to use
+// from concurrent socket.io handlers. The registry only guards its maps, each game serializes
+// access to itself
+type GameRegistry struct {
+	mu sync.RWMutex
+
+	games map[string]*c.GameController
+	// players maps socket ids to the codes of the games the socket is playing
+	players map[string][]string
+	// spectators maps socket ids to the codes of the games the socket is watching
+	spectators map[string][]string
+}
+
+// NewGameRegistry creates an empty registry
+func NewGameRegistry() *GameRegistry {
+	return &GameRegistry{
+		games:      make(map[string]*c.GameController),
+		players:    make(map[string][]string),
+		spectators: make(map[string][]string),
+	}
+}
+
+// Get returns the game with code
+func (r *GameRegistry) Get(code string) (*c.GameController, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	g, exists := r.games[code]
+	return g, exists
+}
+
+// Add registers g under its code
+// @returns false if a game with the same code already exists
+func (r *GameRegistry) Add(g *c.GameController) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.games[g.Code()]; exists {
+		return false
+	}
+
+	r.games[g.Code()] = g
+	return true
+}
+
+// Remove unregisters the game with code
+// @returns wether the game was registered
+func (r *GameRegistry) Remove(code string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.games[code]; !exists {
+		return false
+	}
+
+	delete(r.games, code)
+	return true
+}
+
+// Len returns the number of registered games
+func (r *GameRegistry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.games)
+}
+
+// Games returns every registered game
+func (r *GameRegistry) Games() []*c.GameController {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	games := make([]*c.GameController, 0, len(r.games))
+	for _, g := range r.games {
+		games = append(games, g)
+	}
+
+	return games
+}
+
+// Sockets returns the number of sockets connected
+func (r *GameRegistry) Sockets() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.players)
+}
+
+// Connect registers a socket that isn't playing any games yet
+func (r *GameRegistry) Connect(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.players[id] = []string{}
+}
+
+// Disconnect unregisters a socket
+// @returns the codes of the games the socket was playing and the codes of the games it was watching
+func (r *GameRegistry) Disconnect(id string) ([]string, []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	playing, watching := r.players[id], r.spectators[id]
+	delete(r.players, id)
+	delete(r.spectators, id)
+
+	return playing, watching
+}
+
+// AddPlayerGame records that the socket id is playing the game with code
+func (r *GameRegistry) AddPlayerGame(id string, code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.players[id] {
+		if existing == code {
+			return
+		}
+	}
+
+	r.players[id] = append(r.players[id], code)
+}
+
+// RemovePlayerGame records that the socket id is no longer playing the game with code
+func (r *GameRegistry) RemovePlayerGame(id string, code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removeCode(r.players, id, code)
+}
+
+// AddSpectatorGame records that the socket id is watching the game with code
+func (r *GameRegistry) AddSpectatorGame(id string, code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.spectators[id] {
+		if existing == code {
+			return
+		}
+	}
+
+	r.spectators[id] = append(r.spectators[id], code)
+}
+
+// RemoveSpectatorGame records that the socket id is no longer watching the game with code
+func (r *GameRegistry) RemoveSpectatorGame(id string, code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removeCode(r.spectators, id, code)
+}
+
+func removeCode(sockets map[string][]string, id string, code string) {
+	codes := sockets[id]
+	for i, existing := range codes {
+		if existing == code {
+			sockets[id] = append(codes[:i:i], codes[i+1:]...)
+			return
+		}
+	}
+}
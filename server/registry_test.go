@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+)
+
+// TestRegistryConcurrentAccess adds, gets and removes games and records the sockets playing them
+// from many goroutines at once
+func TestRegistryConcurrentAccess(t *testing.T) {
+	r := NewGameRegistry()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			id := fmt.Sprintf("socket-%d", i)
+			r.Connect(id)
+
+			for j := 0; j < 50; j++ {
+				code := fmt.Sprintf("game-%d-%d", i, j)
+				if !r.Add(c.NewGame(code, c.DefaultTimeControl())) {
+					t.Errorf("failed to add %s", code)
+				}
+				r.AddPlayerGame(id, code)
+
+				if g, exists := r.Get(code); !exists || g.Code() != code {
+					t.Errorf("%s isn't registered", code)
+				}
+				r.Len()
+				r.Games()
+				r.Sockets()
+
+				if j%2 == 0 {
+					r.RemovePlayerGame(id, code)
+					if !r.Remove(code) {
+						t.Errorf("failed to remove %s", code)
+					}
+				}
+			}
+
+			playing, _ := r.Disconnect(id)
+			if len(playing) != 25 {
+				t.Errorf("%s was playing %d games, want 25", id, len(playing))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if games := r.Len(); games != 20*25 {
+		t.Fatalf("registry has %d games, want %d", games, 20*25)
+	}
+	if sockets := r.Sockets(); sockets != 0 {
+		t.Fatalf("registry has %d sockets, want 0", sockets)
+	}
+}
+
+// TestRegistryAddSameCode checks only one of the games added under the same code at once is registered
+func TestRegistryAddSameCode(t *testing.T) {
+	r := NewGameRegistry()
+
+	var added int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if r.Add(c.NewGame("abcdef", c.DefaultTimeControl())) {
+				atomic.AddInt32(&added, 1)
+			}
+			r.Get("abcdef")
+		}()
+	}
+	wg.Wait()
+
+	if added != 1 {
+		t.Fatalf("%d games were added under the same code, want 1", added)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidToken = errors.New("invalid session token")
+var errExpiredToken = errors.New("session token has expired")
+
+// SessionSigner issues and verifies the signed tokens players use to rejoin their games
+type SessionSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewSessionSigner creates a signer whose tokens are valid for ttl after they are issued
+func NewSessionSigner(secret []byte, ttl time.Duration) *SessionSigner {
+	return &SessionSigner{secret, ttl}
+}
+
+// Issue creates a token for the player with key in the game with code
+func (s *SessionSigner) Issue(code string, key string) string {
+	expires := strconv.FormatInt(time.Now().Add(s.ttl).Unix(), 10)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(code + "." + key + "." + expires))
+
+	return payload + "." + s.sign(payload)
+}
+
+// Verify checks the token's signature and expiry
+// @returns the code of the game and the key of the player the token was issued for
+func (s *SessionSigner) Verify(token string) (string, string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(s.sign(parts[0]))) {
+		return "", "", errInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", "", errInvalidToken
+	}
+
+	fields := strings.Split(string(payload), ".")
+	if len(fields) != 3 {
+		return "", "", errInvalidToken
+	}
+
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", "", errInvalidToken
+	} else if time.Now().Unix() > expires {
+		return "", "", errExpiredToken
+	}
+
+	return fields[0], fields[1], nil
+}
+
+func (s *SessionSigner) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
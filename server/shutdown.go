@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	socketio "github.com/googollee/go-socket.io"
+)
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// shuttingDown is set to 1 once the server has been told to stop, no new games are started after that
+var shuttingDown int32
+
+func isShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// handleHealth reports that the server is running
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Status string `json:"status"`
+	}{"ok"})
+}
+
+// handleReady reports if the server can take new games, it isn't ready once it starts shutting down
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	if isShuttingDown() {
+		writeError(w, http.StatusServiceUnavailable, errShuttingDown.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Status string `json:"status"`
+		Games  int    `json:"games"`
+	}{"ok", registry.Len()})
+}
+
+// shutdown stops the server within the configured shutdown timeout. New games are refused, every socket
+// is sent server:shutdown, games in progress are paused and saved so they carry on after a restart and
+// games that are ending are given until the deadline to be rated and archived before the sockets,
+// HTTP server and database are closed
+func shutdown(httpServer *http.Server, server *socketio.Server) {
+	atomic.StoreInt32(&shuttingDown, 1)
+
+	deadline := time.Now().Add(cfg.ShutdownTimeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	logger.Info("shutting down", "timeout", cfg.ShutdownTimeout.String())
+
+	data, _ := json.Marshal(struct {
+		Deadline int64 `json:"deadline"`
+	}{unixMillis(deadline)})
+	server.BroadcastToNamespace("/", "server:shutdown", string(data))
+
+	games := registry.Games()
+	for _, g := range games {
+		g.Pause()
+		saveGame(g)
+	}
+	logger.Info("saved games", "games", len(games))
+
+	// games are counted as soon as they end, before gameEnded starts, so none are missed
+	for atomic.LoadInt32(&endingGames) > 0 && ctx.Err() == nil {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if ending := atomic.LoadInt32(&endingGames); ending > 0 {
+		logger.Warn("shutdown deadline passed before games finished ending", "games", ending)
+	}
+
+	// closing the socket.io server ends its long polling requests so the HTTP server can shut down
+	if err := server.Close(); err != nil {
+		logger.Error("failed to close sockets", "err", err)
+	}
+	if err := httpServer.Shutdown(ctx); err != nil {
+		logger.Error("failed to shut down http server", "err", err)
+	}
+
+	persistMu.Lock()
+	defer persistMu.Unlock()
+
+	if err := store.Close(); err != nil {
+		logger.Error("failed to close database", "err", err)
+	}
+
+	logger.Info("shut down")
+}
@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/freddie-nelson/scuffed-chess/server/accounts"
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/ratings"
+	bolt "go.etcd.io/bbolt"
+)
+
+var gamesBucket = []byte("games")
+var secretsBucket = []byte("secrets")
+
+// ratingsBucket holds a bucket of player ratings for each category
+var ratingsBucket = []byte("ratings")
+
+var accountsBucket = []byte("accounts")
+
+// archiveBucket maps the ids of finished games to their records, archiveCodesBucket indexes the latest
+// game with each code and archivePlayersBucket holds a bucket of game ids for each player
+var archiveBucket = []byte("archive")
+var archiveCodesBucket = []byte("archive-codes")
+var archivePlayersBucket = []byte("archive-players")
+
+// sessionsBucket maps hashes of session ids to the session, so the ids themselves are never stored
+var sessionsBucket = []byte("sessions")
+
+type session struct {
+	Username string    `json:"username"`
+	Expires  time.Time `json:"expires"`
+}
+
+// secretSize is the length in bytes of generated secrets
+const secretSize = 32
+
+// BoltStore is a Store kept in a single BoltDB file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the BoltDB file at path
+func Open(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{gamesBucket, secretsBucket, ratingsBucket, accountsBucket, sessionsBucket, archiveBucket, archiveCodesBucket, archivePlayersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{db}, nil
+}
+
+func (b *BoltStore) SaveGame(s *c.GameSnapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(gamesBucket).Put([]byte(s.Code), data)
+	})
+}
+
+func (b *BoltStore) DeleteGame(code string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(gamesBucket).Delete([]byte(code))
+	})
+}
+
+func (b *BoltStore) LoadGames() ([]*c.GameSnapshot, error) {
+	var snapshots []*c.GameSnapshot
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(gamesBucket).ForEach(func(k, v []byte) error {
+			var s c.GameSnapshot
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+
+			snapshots = append(snapshots, &s)
+			return nil
+		})
+	})
+
+	return snapshots, err
+}
+
+func (b *BoltStore) ArchiveGame(r *c.GameRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		id := []byte(r.ID)
+		if err := tx.Bucket(archiveBucket).Put(id, data); err != nil {
+			return err
+		}
+		if err := tx.Bucket(archiveCodesBucket).Put([]byte(r.Code), id); err != nil {
+			return err
+		}
+
+		for _, p := range []c.PlayerRecord{r.White, r.Black} {
+			games, err := tx.Bucket(archivePlayersBucket).CreateBucketIfNotExists([]byte(PlayerKey(p)))
+			if err != nil {
+				return err
+			}
+
+			if err := games.Put(id, []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *BoltStore) ArchivedGame(code string) (*c.GameRecord, error) {
+	var r *c.GameRecord
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(archiveCodesBucket).Get([]byte(code))
+		if id == nil {
+			return ErrNotFound
+		}
+
+		data := tx.Bucket(archiveBucket).Get(id)
+		if data == nil {
+			return ErrNotFound
+		}
+
+		r = &c.GameRecord{}
+		return json.Unmarshal(data, r)
+	})
+
+	return r, err
+}
+
+func (b *BoltStore) QueryArchive(q ArchiveQuery) ([]*c.GameRecord, error) {
+	records := []*c.GameRecord{}
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		archive := tx.Bucket(archiveBucket)
+
+		// only the player's games need to be looked at when there is one
+		ids := archive
+		if q.Player != "" {
+			if ids = tx.Bucket(archivePlayersBucket).Bucket([]byte(strings.ToLower(q.Player))); ids == nil {
+				return nil
+			}
+		}
+
+		skipped := 0
+		cursor := ids.Cursor()
+		for id, _ := cursor.Last(); id != nil; id, _ = cursor.Prev() {
+			var r c.GameRecord
+			if err := json.Unmarshal(archive.Get(id), &r); err != nil {
+				return err
+			}
+
+			if !q.Matches(&r) {
+				continue
+			}
+			if skipped < q.Offset {
+				skipped++
+				continue
+			}
+
+			records = append(records, &r)
+			if q.Limit > 0 && len(records) == q.Limit {
+				return nil
+			}
+		}
+
+		return nil
+	})
+
+	return records, err
+}
+
+func (b *BoltStore) Rating(player string, category string) (ratings.Rating, error) {
+	r := ratings.NewRating()
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(ratingsBucket).Bucket([]byte(category))
+		if bucket == nil {
+			return nil
+		}
+
+		if data := bucket.Get([]byte(player)); data != nil {
+			return json.Unmarshal(data, &r)
+		}
+
+		return nil
+	})
+
+	return r, err
+}
+
+func (b *BoltStore) SaveRatings(category string, players map[string]ratings.Rating) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(ratingsBucket).CreateBucketIfNotExists([]byte(category))
+		if err != nil {
+			return err
+		}
+
+		for player, r := range players {
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put([]byte(player), data); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *BoltStore) CreateAccount(a *accounts.Account) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(accountsBucket)
+		key := []byte(accounts.Key(a.Username))
+		if bucket.Get(key) != nil {
+			return ErrAccountExists
+		}
+
+		return bucket.Put(key, data)
+	})
+}
+
+func (b *BoltStore) Account(username string) (*accounts.Account, error) {
+	var a *accounts.Account
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(accountsBucket).Get([]byte(accounts.Key(username)))
+		if data == nil {
+			return ErrNotFound
+		}
+
+		a = &accounts.Account{}
+		return json.Unmarshal(data, a)
+	})
+
+	return a, err
+}
+
+func (b *BoltStore) SaveSession(id string, username string, expires time.Time) error {
+	data, err := json.Marshal(session{username, expires})
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Put(sessionKey(id), data)
+	})
+}
+
+func (b *BoltStore) Session(id string) (string, error) {
+	var s session
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(sessionsBucket).Get(sessionKey(id))
+		if data == nil {
+			return ErrNotFound
+		}
+
+		return json.Unmarshal(data, &s)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if time.Now().After(s.Expires) {
+		b.DeleteSession(id)
+		return "", ErrNotFound
+	}
+
+	return s.Username, nil
+}
+
+func (b *BoltStore) DeleteSession(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete(sessionKey(id))
+	})
+}
+
+func sessionKey(id string) []byte {
+	hash := sha256.Sum256([]byte(id))
+	return hash[:]
+}
+
+func (b *BoltStore) Secret(name string) ([]byte, error) {
+	var secret []byte
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(secretsBucket)
+		if existing := bucket.Get([]byte(name)); existing != nil {
+			secret = append([]byte{}, existing...)
+			return nil
+		}
+
+		secret = make([]byte, secretSize)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+
+		return bucket.Put([]byte(name), secret)
+	})
+
+	return secret, err
+}
+
+func (b *BoltStore) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/freddie-nelson/scuffed-chess/server/accounts"
+	c "github.com/freddie-nelson/scuffed-chess/server/chess"
+	"github.com/freddie-nelson/scuffed-chess/server/ratings"
+)
+
+var ErrAccountExists = errors.New("an account with that username already exists")
+var ErrNotFound = errors.New("not found")
+
+// ArchiveQuery filters archived games, zero fields match every game
+type ArchiveQuery struct {
+	Player  string    // account of either player, or "guest:" and the name of a guest
+	Result  string    // "1-0", "0-1" or "1/2-1/2", or "win", "loss" or "draw" from Player's point of view
+	Variant string    // variant the game was played in
+	From    time.Time // earliest time the game ended
+	To      time.Time // latest time the game ended
+	Public  bool      // only games that weren't played in private rooms
+
+	Offset int // matching games to skip, newest first
+	Limit  int // most games to return, 0 for no limit
+}
+
+// GuestPrefix starts the keys of guests, it can't be part of a username so a guest can't pass as an account
+const GuestPrefix = "guest:"
+
+// PlayerKey returns the key games are indexed under for a player regardless of case, players are found
+// by their account if they have one and guests by their name after GuestPrefix
+func PlayerKey(p c.PlayerRecord) string {
+	if p.Account != "" {
+		return strings.ToLower(p.Account)
+	}
+
+	return GuestPrefix + strings.ToLower(p.Name)
+}
+
+// Matches returns true if the archived game r passes the query's filters, Offset and Limit aren't checked
+func (q ArchiveQuery) Matches(r *c.GameRecord) bool {
+	if q.Public && r.Private {
+		return false
+	}
+	if q.Variant != "" && r.Variant != q.Variant {
+		return false
+	}
+	if !q.From.IsZero() && r.EndedAt.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && r.EndedAt.After(q.To) {
+		return false
+	}
+
+	player := strings.ToLower(q.Player)
+	color := ""
+	if player != "" {
+		if PlayerKey(r.White) == player {
+			color = "white"
+		} else if PlayerKey(r.Black) == player {
+			color = "black"
+		} else {
+			return false
+		}
+	}
+
+	switch q.Result {
+	case "":
+		return true
+	case "win":
+		return color != "" && r.Winner == color
+	case "loss":
+		return color != "" && r.Winner != color && r.Winner != ""
+	case "draw":
+		return r.Winner == ""
+	default:
+		return r.Result == q.Result
+	}
+}
+
+// Store persists games, ratings and accounts so they survive the server restarting
+type Store interface {
+	// SaveGame creates or replaces the saved state of a game
+	SaveGame(s *c.GameSnapshot) error
+	// DeleteGame removes a game's saved state
+	DeleteGame(code string) error
+	// LoadGames returns every saved game
+	LoadGames() ([]*c.GameSnapshot, error)
+
+	// ArchiveGame saves a finished game to the archive
+	ArchiveGame(r *c.GameRecord) error
+	// ArchivedGame returns the most recently finished game with code, ErrNotFound is returned if there isn't one
+	ArchivedGame(code string) (*c.GameRecord, error)
+	// QueryArchive returns the archived games matching q, newest first
+	QueryArchive(q ArchiveQuery) ([]*c.GameRecord, error)
+
+	// Rating returns the player's rating in category, players who haven't been rated have a new rating
+	Rating(player string, category string) (ratings.Rating, error)
+	// SaveRatings creates or replaces the ratings of the players in category
+	SaveRatings(category string, players map[string]ratings.Rating) error
+
+	// CreateAccount saves a new account, ErrAccountExists is returned if the username is taken
+	CreateAccount(a *accounts.Account) error
+	// Account returns the account with username, ErrNotFound is returned if there isn't one
+	Account(username string) (*accounts.Account, error)
+
+	// SaveSession saves a login session for the account with username
+	SaveSession(id string, username string, expires time.Time) error
+	// Session returns the username of the account logged in with session id,
+	// ErrNotFound is returned if the session doesn't exist or has expired
+	Session(id string) (string, error)
+	// DeleteSession logs the session with id out
+	DeleteSession(id string) error
+
+	// Secret returns the secret with name, a random one is generated and saved the first time it is requested
+	Secret(name string) ([]byte, error)
+
+	Close() error
+}